@@ -0,0 +1,206 @@
+package controllers
+
+import (
+	"go-auth-app/models"
+	"go-auth-app/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// ListUsers Function to list and search users
+func ListUsers(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", strconv.Itoa(defaultPageSize)))
+	if pageSize < 1 || pageSize > maxPageSize {
+		pageSize = defaultPageSize
+	}
+
+	query := models.DB.Model(&models.User{})
+	if search := strings.TrimSpace(c.Query("q")); search != "" {
+		pattern := "%" + search + "%"
+		query = query.Where("email ILIKE ? OR name ILIKE ?", pattern, pattern)
+	}
+	switch c.Query("status") {
+	case "suspended":
+		query = query.Where("suspended_at IS NOT NULL")
+	case "unverified":
+		query = query.Where("is_verified = ?", false)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to retrieve users"})
+		return
+	}
+
+	var users []models.User
+	if err := query.Preload("Role").Order("id").Offset((page - 1) * pageSize).Limit(pageSize).Find(&users).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to retrieve users"})
+		return
+	}
+
+	c.JSON(200, gin.H{"users": users, "total": total, "page": page, "page_size": pageSize})
+}
+
+// SuspendUser Function to block a user from logging in and end their sessions
+func SuspendUser(c *gin.Context) {
+	user, ok := findTargetUser(c)
+	if !ok {
+		return
+	}
+
+	if err := models.DB.Model(&user).Update("suspended_at", time.Now()).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to suspend user"})
+		return
+	}
+
+	if err := revokeAllSessions(user.ID); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to revoke user sessions"})
+		return
+	}
+
+	c.JSON(200, gin.H{"success": "User suspended"})
+}
+
+// UnsuspendUser Function to lift a suspension
+func UnsuspendUser(c *gin.Context) {
+	user, ok := findTargetUser(c)
+	if !ok {
+		return
+	}
+
+	if err := models.DB.Model(&user).Update("suspended_at", nil).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to unsuspend user"})
+		return
+	}
+
+	c.JSON(200, gin.H{"success": "User unsuspended"})
+}
+
+// VerifyUser Function to mark a user's email address as verified
+func VerifyUser(c *gin.Context) {
+	user, ok := findTargetUser(c)
+	if !ok {
+		return
+	}
+
+	if err := models.DB.Model(&user).Update("is_verified", true).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to verify user"})
+		return
+	}
+
+	c.JSON(200, gin.H{"success": "User verified"})
+}
+
+// DeleteUser Function to delete a user and end their sessions
+func DeleteUser(c *gin.Context) {
+	user, ok := findTargetUser(c)
+	if !ok {
+		return
+	}
+
+	if err := revokeAllSessions(user.ID); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to revoke user sessions"})
+		return
+	}
+
+	// The user row is kept, but their provider accounts are released so they
+	// can sign up again
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.Identity{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&user).Error
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to delete user"})
+		return
+	}
+
+	c.JSON(200, gin.H{"success": "User deleted"})
+}
+
+// SetUserRole Function to change a user's role
+func SetUserRole(c *gin.Context) {
+	var request struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	user, ok := findTargetUser(c)
+	if !ok {
+		return
+	}
+
+	var role models.Role
+	if err := models.DB.Where("name = ?", request.Role).First(&role).Error; err != nil {
+		c.JSON(400, gin.H{"error": "Unknown role"})
+		return
+	}
+
+	if err := models.DB.Model(&user).Update("role_id", role.ID).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to update role"})
+		return
+	}
+
+	// Existing access tokens still carry the old permissions
+	if err := utils.RevokeAllUserTokens(user.ID); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to revoke user tokens"})
+		return
+	}
+
+	c.JSON(200, gin.H{"success": "Role updated", "role": role.Name})
+}
+
+// UnlockUser Function to clear a user's failed login attempts and lockout
+func UnlockUser(c *gin.Context) {
+	user, ok := findTargetUser(c)
+	if !ok {
+		return
+	}
+
+	if err := utils.ResetLoginThrottle(utils.AccountThrottleKey(user.Email)); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to unlock user"})
+		return
+	}
+
+	c.JSON(200, gin.H{"success": "User unlocked"})
+}
+
+// findTargetUser loads the user named in the URL for an admin action. It
+// refuses actions against the caller's own account and against users whose
+// role ranks at or above the caller's, so a moderator cannot suspend an admin.
+func findTargetUser(c *gin.Context) (models.User, bool) {
+	var user models.User
+	if err := models.DB.Preload("Role").First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "User not found"})
+		return user, false
+	}
+
+	if userID, exists := c.Get("userID"); exists && userID.(uint) == user.ID {
+		c.JSON(400, gin.H{"error": "You cannot perform this action on your own account"})
+		return user, false
+	}
+
+	if models.RoleRank(user.Role.Name) >= models.RoleRank(c.GetString("role")) {
+		c.JSON(403, gin.H{"error": "You cannot perform this action on a user whose role is equal to or above yours"})
+		return user, false
+	}
+
+	return user, true
+}
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-auth-app/middlewares"
+	"go-auth-app/models"
+	"go-auth-app/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+func suspend(caller, target models.User) *httptest.ResponseRecorder {
+	r := gin.New()
+	r.POST("/admin/users/:id/suspend", signedInAs(caller), middlewares.RequirePermission(models.PermissionUsersSuspend), SuspendUser)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, fmt.Sprintf("/admin/users/%d/suspend", target.ID), nil))
+	return w
+}
+
+func isSuspended(t *testing.T, user models.User) bool {
+	t.Helper()
+	var stored models.User
+	if err := models.DB.First(&stored, user.ID).Error; err != nil {
+		t.Fatalf("load user: %v", err)
+	}
+	return stored.SuspendedAt != nil
+}
+
+func TestModeratorCannotSuspendAdmin(t *testing.T) {
+	setupTestDB(t)
+	moderator := createTestUser(t, "moderator@example.com", models.RoleModerator)
+	admin := createTestUser(t, "admin@example.com", models.RoleAdmin)
+
+	w := suspend(moderator, admin)
+	if w.Code != 403 {
+		t.Fatalf("status = %d, want 403: %s", w.Code, w.Body.String())
+	}
+	if isSuspended(t, admin) {
+		t.Fatal("admin was suspended")
+	}
+}
+
+func TestModeratorCannotSuspendModerator(t *testing.T) {
+	setupTestDB(t)
+	moderator := createTestUser(t, "moderator@example.com", models.RoleModerator)
+	other := createTestUser(t, "other@example.com", models.RoleModerator)
+
+	if w := suspend(moderator, other); w.Code != 403 {
+		t.Fatalf("status = %d, want 403: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestModeratorCanSuspendUser(t *testing.T) {
+	setupTestDB(t)
+	moderator := createTestUser(t, "moderator@example.com", models.RoleModerator)
+	user := createTestUser(t, "user@example.com", models.RoleUser)
+
+	if w := suspend(moderator, user); w.Code != 200 {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if !isSuspended(t, user) {
+		t.Fatal("user was not suspended")
+	}
+}
+
+func TestDeletedUsersEmailCanBeUsedAgain(t *testing.T) {
+	setupTestDB(t)
+	admin := createTestUser(t, "admin@example.com", models.RoleAdmin)
+	user := createTestUser(t, "user@example.com", models.RoleUser)
+	if err := models.DB.Create(&models.Identity{UserID: user.ID, Provider: "google", Subject: "123", EmailVerified: true}).Error; err != nil {
+		t.Fatalf("create identity: %v", err)
+	}
+
+	r := gin.New()
+	r.DELETE("/admin/users/:id", signedInAs(admin), middlewares.RequirePermission(models.PermissionUsersDelete), DeleteUser)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/admin/users/%d", user.ID), nil))
+	if w.Code != 200 {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+
+	again := createTestUser(t, "user@example.com", models.RoleUser)
+	if err := models.DB.Create(&models.Identity{UserID: again.ID, Provider: "google", Subject: "123", EmailVerified: true}).Error; err != nil {
+		t.Fatalf("relink identity: %v", err)
+	}
+}
+
+func TestVerifyAndUnlockRespectRoleRank(t *testing.T) {
+	setupTestDB(t)
+	moderator := createTestUser(t, "moderator@example.com", models.RoleModerator)
+	admin := createTestUser(t, "admin@example.com", models.RoleAdmin)
+	other := createTestUser(t, "other@example.com", models.RoleModerator)
+	user := createTestUser(t, "user@example.com", models.RoleUser)
+	models.DB.Model(&models.User{}).Where("id IN ?", []uint{moderator.ID, admin.ID, other.ID, user.ID}).Update("is_verified", false)
+
+	r := gin.New()
+	r.POST("/admin/users/:id/verify", signedInAs(moderator), middlewares.RequirePermission(models.PermissionUsersVerify), VerifyUser)
+	r.POST("/admin/users/:id/unlock", signedInAs(moderator), middlewares.RequirePermission(models.PermissionUsersUnlock), UnlockUser)
+
+	tests := []struct {
+		action string
+		target models.User
+		status int
+	}{
+		{"verify", admin, 403},
+		{"verify", other, 403},
+		{"verify", moderator, 400},
+		{"verify", user, 200},
+		{"unlock", admin, 403},
+		{"unlock", other, 403},
+		{"unlock", moderator, 400},
+		{"unlock", user, 200},
+	}
+	for _, tt := range tests {
+		for i := 0; i < utils.AccountThrottlePolicy.Threshold; i++ {
+			if _, _, err := utils.RecordLoginFailure(utils.AccountThrottleKey(tt.target.Email), utils.AccountThrottlePolicy); err != nil {
+				t.Fatalf("record login failure: %v", err)
+			}
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, fmt.Sprintf("/admin/users/%d/%s", tt.target.ID, tt.action), nil))
+		if w.Code != tt.status {
+			t.Errorf("%s %s: status = %d, want %d: %s", tt.action, tt.target.Email, w.Code, tt.status, w.Body.String())
+			continue
+		}
+
+		var stored models.User
+		models.DB.First(&stored, tt.target.ID)
+		locked, err := utils.LoginLockedFor(utils.AccountThrottleKey(tt.target.Email))
+		if err != nil {
+			t.Fatalf("load lockout: %v", err)
+		}
+		changed := stored.IsVerified
+		if tt.action == "unlock" {
+			changed = locked == 0
+		}
+		if changed != (tt.status == 200) {
+			t.Errorf("%s %s: changed = %v with status %d", tt.action, tt.target.Email, changed, w.Code)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"go-auth-app/models"
+	"go-auth-app/utils"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxAPIKeysPerUser = 25
+
+// ListAPIKeys Function to list the current user's API keys
+func ListAPIKeys(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var keys []models.APIKey
+	if err := models.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to retrieve API keys"})
+		return
+	}
+
+	c.JSON(200, gin.H{"api_keys": keys})
+}
+
+// CreateAPIKey Function to create a named, scoped API key. The key is only
+// returned once.
+func CreateAPIKey(c *gin.Context) {
+	var request struct {
+		Name          string   `json:"name" binding:"required"`
+		Scopes        []string `json:"scopes" binding:"required"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": "Name and scopes are required"})
+		return
+	}
+
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" || len(request.Name) > 100 {
+		c.JSON(400, gin.H{"error": "Name must be between 1 and 100 characters"})
+		return
+	}
+	if len(request.Scopes) == 0 {
+		c.JSON(400, gin.H{"error": "At least one scope is required"})
+		return
+	}
+	for _, scope := range request.Scopes {
+		if !validAPIKeyScope(scope) {
+			c.JSON(400, gin.H{"error": "Unknown scope: " + scope, "valid_scopes": models.APIKeyScopes})
+			return
+		}
+	}
+	if request.ExpiresInDays < 0 {
+		c.JSON(400, gin.H{"error": "expires_in_days must be positive"})
+		return
+	}
+
+	userID := c.MustGet("userID").(uint)
+
+	var active int64
+	if err := models.DB.Model(&models.APIKey{}).Where("user_id = ? AND revoked_at IS NULL", userID).Count(&active).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to create API key"})
+		return
+	}
+	if active >= maxAPIKeysPerUser {
+		c.JSON(400, gin.H{"error": "Too many active API keys, revoke one first"})
+		return
+	}
+
+	key, prefix, hash, err := utils.GenerateAPIKey()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	apiKey := models.APIKey{
+		UserID:  userID,
+		Name:    request.Name,
+		Prefix:  prefix,
+		KeyHash: hash,
+		Scopes:  request.Scopes,
+	}
+	if request.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, request.ExpiresInDays)
+		apiKey.ExpiresAt = &expiresAt
+	}
+	if err := models.DB.Create(&apiKey).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	c.JSON(201, gin.H{
+		"success": "API key created. Copy it now, it will not be shown again",
+		"key":     key,
+		"api_key": apiKey,
+	})
+}
+
+// RevokeAPIKey Function to revoke one of the current user's API keys
+func RevokeAPIKey(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	result := models.DB.Model(&models.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", c.Param("id"), userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		c.JSON(500, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(404, gin.H{"error": "API key not found"})
+		return
+	}
+
+	c.JSON(200, gin.H{"success": "API key revoked"})
+}
+
+func validAPIKeyScope(scope string) bool {
+	for _, s := range models.APIKeyScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -1,21 +1,38 @@
 package controllers
 
 import (
-	"context"
-	"crypto/rand"
-	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"go-auth-app/models"
 	"go-auth-app/utils"
-	"os"
+	"log"
+	"math"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
+	"gorm.io/gorm"
 )
 
+const passwordResetTTL = time.Hour
+
+// emailVerificationTTL is how long the link in the signup email stays valid
+const emailVerificationTTL = 72 * time.Hour
+
+// dummyPasswordHash is compared against when a login names an unknown account
+var dummyPasswordHash, _ = utils.GenerateHashPassword("not-a-real-password")
+
+// sendEmail sends an email in the background so the request does not wait
+// for the SMTP server. Failures are logged.
+func sendEmail(to, subject, templateFile string, data interface{}) {
+	go func() {
+		if err := utils.SendEmail(to, subject, templateFile, data); err != nil {
+			log.Printf("Failed to send %q email: %v", subject, err)
+		}
+	}()
+}
+
 // Login Function to authenticate a user
 func Login(c *gin.Context) {
 	var user models.User
@@ -24,48 +41,105 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	accountKey := utils.AccountThrottleKey(user.Email)
+	ipKey := utils.IPThrottleKey(c.ClientIP())
+
+	lockedFor, err := utils.LoginLockedFor(accountKey, ipKey)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to check login attempts"})
+		return
+	}
+	if lockedFor > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(lockedFor.Seconds()))))
+		c.JSON(429, gin.H{"error": "Too many failed login attempts. Please try again later."})
+		return
+	}
+
 	var existingUser models.User
 	models.DB.Where("email = ?", user.Email).First(&existingUser)
-	if existingUser.ID == 0 {
-		c.JSON(401, gin.H{"error": "User does not exists!"})
+
+	// Always run bcrypt so unknown accounts take as long as wrong passwords
+	passwordHash := existingUser.Password
+	if existingUser.ID == 0 || passwordHash == "" {
+		passwordHash = dummyPasswordHash
+	}
+	validPassword := utils.CompareHashPassword(user.Password, passwordHash) && existingUser.ID != 0 && existingUser.Password != ""
+
+	if !validPassword {
+		recordLoginFailure(existingUser, accountKey, ipKey)
+		c.JSON(401, gin.H{"error": "Invalid email or password"})
 		return
 	}
 
+	// With two-factor authentication the failures are only forgotten once the
+	// second factor passes too, so knowing the password does not reset the
+	// count of second factor guesses
+	if !existingUser.TOTPEnabled {
+		if err := utils.ResetLoginThrottle(accountKey); err != nil {
+			c.JSON(500, gin.H{"error": "Failed to record login attempt"})
+			return
+		}
+	}
+
 	if !existingUser.IsVerified {
 		c.JSON(403, gin.H{"error": "Please verify your email address before logging in"})
 		return
 	}
 
-	errHash := utils.CompareHashPassword(user.Password, existingUser.Password)
-	if !errHash {
-		c.JSON(400, gin.H{"error": "Invalid password!"})
-		return
-	}
+	completeLogin(c, existingUser, models.AuthMethodPassword)
+}
 
-	tokenString, err := utils.GenerateJWT(user.ID, user.Email)
+// recordLoginFailure counts a failed login against the account and the
+// client IP and notifies the owner when their account gets locked.
+func recordLoginFailure(user models.User, accountKey, ipKey string) {
+	locked, lockedUntil, err := utils.RecordLoginFailure(accountKey, utils.AccountThrottlePolicy)
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Error generating token"})
-		return
+		log.Printf("Failed to record login failure: %v", err)
+	}
+	if _, _, err := utils.RecordLoginFailure(ipKey, utils.IPThrottlePolicy); err != nil {
+		log.Printf("Failed to record login failure: %v", err)
 	}
 
-	c.JSON(200, gin.H{"success": "Successfully logged in", "access_token": tokenString})
+	if locked && user.ID != 0 {
+		data := map[string]string{
+			"LockedUntil": lockedUntil.UTC().Format("January 2, 2006 15:04 MST"),
+			"ResetLink":   fmt.Sprintf("%s/forgot-password", utils.FrontendURL()),
+		}
+		templatePath := "templates/account_locked_template.html"
+		sendEmail(user.Email, "Your Account Has Been Temporarily Locked", templatePath, data)
+	}
 }
 
 // SignUp Function to create a new user
 func Signup(c *gin.Context) {
-	var user models.User
-	if err := c.ShouldBindJSON(&user); err != nil {
+	// Bind to a request type rather than models.User so clients cannot set
+	// fields such as the role or suspension state.
+	var request struct {
+		Name     string `json:"name"`
+		Email    string `json:"email" binding:"required"`
+		Password string `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
+	user := models.User{Name: request.Name, Email: request.Email, Password: request.Password}
 
 	var existingUser models.User
 	models.DB.Where("email = ?", user.Email).First(&existingUser)
+	if existingUser.ID != 0 && existingUser.Password == "" {
+		offerPasswordForExistingAccount(c, existingUser)
+		return
+	}
 	if existingUser.ID != 0 {
 		c.JSON(409, gin.H{"error": "User already exists"})
 		return
 	}
 
+	if !acceptablePassword(c, user.Password, user.Email, user.Name) {
+		return
+	}
+
 	var errHash error
 	user.Password, errHash = utils.GenerateHashPassword(user.Password)
 	if errHash != nil {
@@ -74,25 +148,58 @@ func Signup(c *gin.Context) {
 	}
 
 	user.IsVerified = false
-	models.DB.Create(&user)
+	if err := models.DB.Create(&user).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to create user"})
+		return
+	}
 
-	// Generate JWT Token
-	tokenString, err := utils.GenerateJWT(user.ID, user.Email)
+	token, err := utils.CreateEmailToken(user.ID, models.EmailTokenVerification, emailVerificationTTL)
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Failed to generate JWT"})
+		c.JSON(500, gin.H{"error": "Failed to create verification token"})
 		return
 	}
 
-	verificationLink := fmt.Sprintf("https://jokemaster-go.netlify.app/verify?token=%s", tokenString)
+	verificationLink := fmt.Sprintf("%s/verify?token=%s", utils.FrontendURL(), token)
 
 	data := map[string]string{
 		"VerificationLink": verificationLink,
 	}
 	templatePath := "templates/email_verification_template.html"
-	go utils.SendEmail(user.Email, "Please Verify Your Email", templatePath, data)
+	sendEmail(user.Email, "Please Verify Your Email", templatePath, data)
 	c.JSON(200, gin.H{"success": "User created successfully! Please check your email to verify your account."})
 }
 
+// offerPasswordForExistingAccount handles a signup for an email that already
+// signs in through an external provider. The password from the request is
+// not stored; instead the owner of the address is emailed a link to add one,
+// so nobody can attach a password to an account they do not own.
+func offerPasswordForExistingAccount(c *gin.Context, user models.User) {
+	var providers []string
+	models.DB.Model(&models.Identity{}).Where("user_id = ?", user.ID).Distinct().Pluck("provider", &providers)
+	names := make([]string, 0, len(providers))
+	for _, provider := range providers {
+		names = append(names, providerDisplayName(provider))
+	}
+	if len(names) == 0 {
+		names = append(names, "a passkey or sign-in link")
+	}
+
+	token, err := utils.CreateEmailToken(user.ID, models.EmailTokenPasswordReset, passwordResetTTL)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to create reset token"})
+		return
+	}
+
+	data := map[string]string{
+		"ResetLink": fmt.Sprintf("%s/reset-password?token=%s", utils.FrontendURL(), token),
+		"ExpiresIn": "1 hour",
+		"Providers": strings.Join(names, " or "),
+	}
+	templatePath := "templates/add_password_template.html"
+	sendEmail(user.Email, "Add a Password to Your JokeMaster Account", templatePath, data)
+	c.JSON(200, gin.H{"success": "An account with this email already exists. We have emailed you a link to add a password to it."})
+}
+
 // Verify email function to verify an email address
 func VerifyEmail(c *gin.Context) {
 	tokenString := c.Query("token")
@@ -101,19 +208,33 @@ func VerifyEmail(c *gin.Context) {
 		return
 	}
 
-	claims, err := utils.ParseJWT(tokenString)
+	emailToken, err := utils.ConsumeEmailToken(tokenString, models.EmailTokenVerification)
 	if err != nil {
-		c.JSON(401, gin.H{"error": "Unauthorized"})
+		c.JSON(401, gin.H{"error": "Invalid or expired verification link"})
 		return
 	}
 
 	var user models.User
-	models.DB.Where("email = ?", claims.Email).First(&user)
+	models.DB.First(&user, emailToken.UserID)
 	if user.ID == 0 {
 		c.JSON(400, gin.H{"error": "Invalid token"})
 		return
 	}
 
+	if !user.IsVerified {
+		removed, err := removeUnprovenLoginMethods(models.DB, user.ID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to verify email"})
+			return
+		}
+		if removed {
+			if err := revokeAllSessions(user.ID); err != nil {
+				c.JSON(500, gin.H{"error": "Failed to revoke existing sessions"})
+				return
+			}
+		}
+	}
+
 	user.IsVerified = true
 	user.UpdatedAt = time.Now()
 	models.DB.Save(&user)
@@ -147,162 +268,182 @@ func Home(c *gin.Context) {
 	c.JSON(200, gin.H{"success": "Welcome to JokeMaster!", "email": claims.Email})
 }
 
-// Logout Function to logout a user
+// Logout Function to logout a user by revoking the current token
 func Logout(c *gin.Context) {
-	c.JSON(200, gin.H{
-		"success": "Successfully logged out!",
-	})
-}
-
-// ResetPassword Function to reset user password
-func ResetPassword(c *gin.Context) {
-	var user models.User
-
-	if err := c.ShouldBindJSON(&user); err != nil {
-		c.JSON(400, gin.H{"error": "Invalid request"})
+	value, exists := c.Get("claims")
+	if !exists {
+		c.JSON(401, gin.H{"error": "Unauthorized"})
 		return
 	}
+	claims := value.(*models.Claims)
 
-	var existingUser models.User
-	models.DB.Where("email = ?", user.Email).First(&existingUser)
-	if existingUser.ID == 0 {
-		c.JSON(401, gin.H{"error": "User does not exist"})
+	if err := utils.RevokeToken(claims.ID, claims.UserID, claims.ExpiresAt.Time); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to revoke token"})
 		return
 	}
 
-	var errHash error
-	user.Password, errHash = utils.GenerateHashPassword(user.Password)
-	if errHash != nil {
-		c.JSON(500, gin.H{"error": "Could not generate hash password"})
-		return
+	if claims.SessionID != 0 {
+		if err := utils.RevokeSession(claims.UserID, claims.SessionID); err != nil && !errors.Is(err, utils.ErrSessionNotFound) {
+			c.JSON(500, gin.H{"error": "Failed to end session"})
+			return
+		}
 	}
 
-	models.DB.Model(&existingUser).Update("password", user.Password)
-	c.JSON(200, gin.H{"success": "Password reset successfully"})
+	// The refresh token is optional; revoke its family when the client sends it
+	if refreshToken, ok := refreshTokenFromRequest(c); ok {
+		if err := utils.RevokeRefreshToken(refreshToken); err != nil && !errors.Is(err, utils.ErrInvalidRefreshToken) {
+			c.JSON(500, gin.H{"error": "Failed to revoke refresh token"})
+			return
+		}
+	}
+
+	clearSessionCookies(c)
+	c.JSON(200, gin.H{
+		"success": "Successfully logged out!",
+	})
 }
 
-func Profile(c *gin.Context) {
+// LogoutAll Function to revoke every token held by the current user
+func LogoutAll(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
 		c.JSON(401, gin.H{"error": "Unauthorized"})
 		return
 	}
 
-	var prompts []models.Prompt
-	result := models.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&prompts)
-
-	if result.Error != nil {
-		c.JSON(500, gin.H{"error": "Failed to retrieve prompts"})
+	if err := revokeAllSessions(userID.(uint)); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to revoke tokens"})
 		return
 	}
 
-	c.JSON(200, prompts)
+	clearSessionCookies(c)
+	c.JSON(200, gin.H{"success": "Successfully logged out of all sessions!"})
 }
 
-// GenerateState generates a random state string
-func generateState() (string, error) {
-	b := make([]byte, 16)
-	if _, err := rand.Read(b); err != nil {
-		return "", err
+// ForgotPassword Function to email a password reset link
+func ForgotPassword(c *gin.Context) {
+	var request struct {
+		Email string `json:"email" binding:"required"`
 	}
-	return base64.URLEncoding.EncodeToString(b), nil
-}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	// Respond identically whether or not the account exists
+	response := gin.H{"success": "If an account exists for that email, a password reset link has been sent."}
 
-// GoogleLogin initiates the Google OAuth2 flow
-func GoogleLogin(c *gin.Context) {
-	state, err := generateState()
+	var user models.User
+	models.DB.Where("email = ?", request.Email).First(&user)
+	if user.ID == 0 {
+		c.JSON(200, response)
+		return
+	}
+
+	token, err := utils.CreateEmailToken(user.ID, models.EmailTokenPasswordReset, passwordResetTTL)
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Failed to generate state"})
+		c.JSON(500, gin.H{"error": "Failed to create reset token"})
 		return
 	}
 
-	url := utils.GetGoogleOAuthURL(state)
-	c.Redirect(302, url)
+	data := map[string]string{
+		"ResetLink": fmt.Sprintf("%s/reset-password?token=%s", utils.FrontendURL(), token),
+		"ExpiresIn": "1 hour",
+	}
+	templatePath := "templates/password_reset_template.html"
+	sendEmail(user.Email, "Reset Your Password", templatePath, data)
+	c.JSON(200, response)
 }
 
-// GoogleAuthCallback handles the callback from Google OAuth2
-func GoogleAuthCallback(c *gin.Context) {
-	stateFromQuery := c.Query("state")
-	if stateFromQuery == "" {
-		c.JSON(400, gin.H{"error": "State parameter missing"})
+// ResetPassword Function to set a new password using an emailed reset token
+func ResetPassword(c *gin.Context) {
+	var request struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
 		return
 	}
 
-	code := c.Query("code")
-	if code == "" {
-		c.JSON(400, gin.H{"error": "Code not found"})
+	emailToken, err := utils.FindEmailToken(request.Token, models.EmailTokenPasswordReset)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid or expired reset token"})
 		return
 	}
 
-	token, err := utils.ExchangeCode(code)
-	if err != nil {
-		c.JSON(500, gin.H{"error": "Failed to exchange code for token"})
+	var user models.User
+	if err := models.DB.First(&user, emailToken.UserID).Error; err != nil {
+		c.JSON(400, gin.H{"error": "Invalid or expired reset token"})
 		return
 	}
 
-	client := utils.GoogleOauthConfig.Client(context.Background(), token)
-	userInfoResp, err := client.Get("https://www.googleapis.com/oauth2/v2/userinfo")
-	if err != nil {
-		c.JSON(500, gin.H{"error": "Failed to get user info"})
+	// Check the password before using up the token so the user can retry
+	if !acceptablePassword(c, request.Password, user.Email, user.Name) {
 		return
 	}
-	defer userInfoResp.Body.Close()
 
-	var userInfo struct {
-		ID            string `json:"id"`
-		Email         string `json:"email"`
-		VerifiedEmail bool   `json:"verified_email"`
-		Name          string `json:"name"`
-		GivenName     string `json:"given_name"`
-		FamilyName    string `json:"family_name"`
-		Picture       string `json:"picture"`
-		Locale        string `json:"locale"`
+	emailToken, err = utils.ConsumeEmailToken(request.Token, models.EmailTokenPasswordReset)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid or expired reset token"})
+		return
 	}
 
-	if err := json.NewDecoder(userInfoResp.Body).Decode(&userInfo); err != nil {
-		c.JSON(500, gin.H{"error": "Failed to decode user info"})
+	hashedPassword, err := utils.GenerateHashPassword(request.Password)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Could not generate hash password"})
 		return
 	}
 
-	var user models.User
-	if err := models.DB.Where("email = ?", userInfo.Email).First(&user).Error; err != nil {
-		user = models.User{
-			Name:              userInfo.Name,
-			Email:             userInfo.Email,
-			IsVerified:        userInfo.VerifiedEmail,
-			ImageURL:          userInfo.Picture,
-			GoogleID:          userInfo.ID,
-			Provider:          "google",
-			VerificationToken: "",
-			Prompts:           []models.Prompt{},
-		}
-		if err := models.DB.Create(&user).Error; err != nil {
-			c.JSON(500, gin.H{"error": "Failed to create user"})
-			return
+	// Receiving the reset link proves ownership of the address
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		if !user.IsVerified {
+			if _, err := removeUnprovenLoginMethods(tx, user.ID); err != nil {
+				return err
+			}
 		}
+		return tx.Model(&models.User{}).Where("id = ?", emailToken.UserID).Updates(map[string]interface{}{
+			"password":    hashedPassword,
+			"is_verified": true,
+		}).Error
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to reset password"})
+		return
 	}
 
-	// Generate JWT Token
-	jwtToken, err := utils.GenerateJWT(user.ID, user.Email)
-	if err != nil {
-		c.JSON(500, gin.H{"error": "Failed to generate JWT"})
+	if err := revokeAllSessions(emailToken.UserID); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to revoke existing sessions"})
 		return
 	}
 
-	if err := godotenv.Load(); err != nil {
-		fmt.Println("No .env file found, proceeding without it")
-	} else {
-		fmt.Println(".env file loaded successfully")
+	c.JSON(200, gin.H{"success": "Password reset successfully"})
+}
+
+// acceptablePassword rejects a new password that breaks the password policy
+// or appears in the breached password corpus, listing every problem.
+func acceptablePassword(c *gin.Context, password, email, name string) bool {
+	if problems := utils.ValidatePassword(password, email, name); problems != nil {
+		c.JSON(400, gin.H{"error": "Password does not meet the requirements", "fields": problems})
+		return false
+	}
+	return true
+}
+
+func Profile(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
 	}
 
-	// Redirect to frontend with token
-	frontendURL := os.Getenv("REACT_FRONTEND_URL")
-	if frontendURL == "" {
-		fmt.Println("REACT_FRONTEND_URL is not set in environment variables")
-		c.JSON(500, gin.H{"error": "Configuration error"})
+	var prompts []models.Prompt
+	result := models.DB.Preload("Jokes", orderJokes).Where("user_id = ?", userID).Order("created_at DESC").Find(&prompts)
+
+	if result.Error != nil {
+		c.JSON(500, gin.H{"error": "Failed to retrieve prompts"})
 		return
 	}
 
-	redirectURL := fmt.Sprintf("%s/auth/google/callback?token=%s", frontendURL, jwtToken)
-	c.Redirect(302, redirectURL)
+	c.JSON(200, prompts)
 }
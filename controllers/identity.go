@@ -0,0 +1,394 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"go-auth-app/models"
+	"go-auth-app/utils"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ListIdentities Function to list the ways the current user can sign in
+func ListIdentities(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var identities []models.Identity
+	if err := models.DB.Where("user_id = ?", user.ID).Order("created_at").Find(&identities).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to retrieve login methods"})
+		return
+	}
+
+	var passkeys int64
+	if err := models.DB.Model(&models.WebAuthnCredential{}).Where("user_id = ?", user.ID).Count(&passkeys).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to retrieve login methods"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"password":   user.Password != "",
+		"passkeys":   passkeys,
+		"identities": identities,
+		"providers":  utils.OAuthProviderNames(),
+	})
+}
+
+// StartIdentityLink Function to start linking an external provider to the
+// current user. The returned URL starts the provider login; once it is done
+// the frontend finishes the link with CompleteIdentityLink.
+func StartIdentityLink(c *gin.Context) {
+	provider, err := utils.GetOAuthProvider(c.Param("provider"))
+	if err != nil {
+		c.JSON(404, gin.H{"error": "Unknown login provider"})
+		return
+	}
+
+	var request struct {
+		RedirectTo string `json:"redirect_to"`
+	}
+	_ = c.ShouldBindJSON(&request)
+
+	redirectTo, err := utils.SafeRedirectPath(request.RedirectTo)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	linkToken, err := utils.CreateAuthCode(user.ID, models.AuthCodeIdentityLink, "", utils.IdentityLinkTTL)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to start account linking"})
+		return
+	}
+
+	query := url.Values{}
+	query.Set("link_token", linkToken)
+	if redirectTo != "" {
+		query.Set("redirect_to", redirectTo)
+	}
+
+	c.JSON(200, gin.H{
+		"url":        "/auth/" + url.PathEscape(provider.Name) + "?" + query.Encode(),
+		"expires_in": int(utils.IdentityLinkTTL.Seconds()),
+	})
+}
+
+// CompleteIdentityLink Function to add the provider account from a link
+// started with StartIdentityLink to the current user. The link only completes
+// for the user who started it, so a link URL opened by someone else cannot
+// attach their provider account to the sender's user.
+func CompleteIdentityLink(c *gin.Context) {
+	var request struct {
+		LinkToken string `json:"link_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userID := c.MustGet("userID").(uint)
+	link, err := utils.ConsumeSignedInLink(request.LinkToken, userID)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid or expired link request"})
+		return
+	}
+
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		return createIdentity(tx, userID, utils.PendingLinkIdentity(link))
+	})
+	if errors.Is(err, errIdentityInUse) {
+		c.JSON(409, gin.H{"error": "This account is already linked to another user"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to link account"})
+		return
+	}
+
+	c.JSON(200, gin.H{"success": "Login method linked", "provider": link.Provider})
+}
+
+// UnlinkIdentity Function to remove an external provider from the current user
+func UnlinkIdentity(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var identity models.Identity
+	if err := models.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&identity).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Login method not found"})
+		return
+	}
+
+	if !ensureAnotherLoginMethod(c, userID) {
+		return
+	}
+
+	if err := models.DB.Unscoped().Delete(&identity).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to remove login method"})
+		return
+	}
+
+	c.JSON(200, gin.H{"success": "Login method removed"})
+}
+
+// ConfirmLinkWithPassword Function to link a pending external identity by
+// proving ownership of the matching account with its password
+func ConfirmLinkWithPassword(c *gin.Context) {
+	var request struct {
+		LinkToken string `json:"link_token" binding:"required"`
+		Password  string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	link, err := utils.FindPendingLink(request.LinkToken)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid or expired link request"})
+		return
+	}
+
+	var user models.User
+	if err := models.DB.First(&user, link.UserID).Error; err != nil {
+		c.JSON(400, gin.H{"error": "Invalid or expired link request"})
+		return
+	}
+
+	accountKey := utils.AccountThrottleKey(user.Email)
+	ipKey := utils.IPThrottleKey(c.ClientIP())
+
+	lockedFor, err := utils.LoginLockedFor(accountKey, ipKey)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to check login attempts"})
+		return
+	}
+	if lockedFor > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(lockedFor.Seconds()))))
+		c.JSON(429, gin.H{"error": "Too many failed login attempts. Please try again later."})
+		return
+	}
+
+	if user.Password == "" || !utils.CompareHashPassword(request.Password, user.Password) {
+		recordLoginFailure(user, accountKey, ipKey)
+		c.JSON(401, gin.H{"error": "Invalid password"})
+		return
+	}
+
+	if err := utils.ResetLoginThrottle(accountKey); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to record login attempt"})
+		return
+	}
+
+	link, err = utils.ConsumePendingLink(request.LinkToken, false)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid or expired link request"})
+		return
+	}
+
+	finishPendingLink(c, link, false)
+}
+
+// SendLinkConfirmation Function to email the owner of the matching account a
+// link that confirms a pending external identity
+func SendLinkConfirmation(c *gin.Context) {
+	var request struct {
+		LinkToken string `json:"link_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	link, err := utils.FindPendingLink(request.LinkToken)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid or expired link request"})
+		return
+	}
+
+	var user models.User
+	if err := models.DB.First(&user, link.UserID).Error; err != nil {
+		c.JSON(400, gin.H{"error": "Invalid or expired link request"})
+		return
+	}
+
+	token, err := utils.CreatePendingLinkConfirmation(link)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to create confirmation link"})
+		return
+	}
+
+	data := map[string]string{
+		"ConfirmLink":   fmt.Sprintf("%s/auth/link/confirm?token=%s", utils.FrontendURL(), token),
+		"Provider":      providerDisplayName(link.Provider),
+		"ProviderEmail": link.Email,
+		"ExpiresIn":     "15 minutes",
+	}
+	templatePath := "templates/link_identity_template.html"
+	sendEmail(user.Email, "Confirm Your New Sign-In Method", templatePath, data)
+	c.JSON(200, gin.H{"success": "We have emailed you a link to confirm this sign-in method."})
+}
+
+// ConfirmLinkByEmail Function to link a pending external identity with the
+// token from the confirmation email
+func ConfirmLinkByEmail(c *gin.Context) {
+	var request struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	link, err := utils.ConsumePendingLink(request.Token, true)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid or expired confirmation link"})
+		return
+	}
+
+	finishPendingLink(c, link, true)
+}
+
+// finishPendingLink links a confirmed identity and logs the user in.
+//
+// Confirming by email proves ownership of the address. If the account was
+// never verified, its password and other login methods were set by someone
+// who may not own the address, so they are removed and existing sessions are
+// ended.
+func finishPendingLink(c *gin.Context, link *models.PendingLink, byEmail bool) {
+	var user models.User
+	revokeSessions := false
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&user, link.UserID).Error; err != nil {
+			return err
+		}
+
+		if byEmail && !user.IsVerified {
+			removed, err := removeUnprovenLoginMethods(tx, user.ID)
+			if err != nil {
+				return err
+			}
+			revokeSessions = removed
+		}
+
+		if err := createIdentity(tx, user.ID, utils.PendingLinkIdentity(link)); err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{}
+		if byEmail {
+			if !user.IsVerified && user.Password != "" {
+				updates["password"] = ""
+				revokeSessions = true
+			}
+			updates["is_verified"] = true
+		} else if link.EmailVerified && strings.EqualFold(link.Email, user.Email) {
+			updates["is_verified"] = true
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+		return tx.Model(&user).Updates(updates).Error
+	})
+	if errors.Is(err, errIdentityInUse) {
+		c.JSON(409, gin.H{"error": "This account is already linked to another user"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to link account"})
+		return
+	}
+
+	if revokeSessions {
+		if err := revokeAllSessions(user.ID); err != nil {
+			c.JSON(500, gin.H{"error": "Failed to revoke existing sessions"})
+			return
+		}
+	}
+
+	if err := models.DB.First(&user, user.ID).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to link account"})
+		return
+	}
+
+	if !user.IsVerified {
+		c.JSON(403, gin.H{"error": "Please verify your email address before logging in"})
+		return
+	}
+
+	completeLogin(c, user, link.Provider)
+}
+
+// ensureAnotherLoginMethod refuses to remove a login method when it is the
+// user's last one, so nobody can lock themselves out of their account.
+func ensureAnotherLoginMethod(c *gin.Context, userID uint) bool {
+	count, err := loginMethodCount(userID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to check login methods"})
+		return false
+	}
+	if count <= 1 {
+		c.JSON(400, gin.H{"error": "You cannot remove your last login method"})
+		return false
+	}
+	return true
+}
+
+// loginMethodCount counts the password, linked identities and passkeys a
+// user can sign in with.
+func loginMethodCount(userID uint) (int64, error) {
+	var user models.User
+	if err := models.DB.Select("password").First(&user, userID).Error; err != nil {
+		return 0, err
+	}
+
+	var identities, passkeys int64
+	if err := models.DB.Model(&models.Identity{}).Where("user_id = ?", userID).Count(&identities).Error; err != nil {
+		return 0, err
+	}
+	if err := models.DB.Model(&models.WebAuthnCredential{}).Where("user_id = ?", userID).Count(&passkeys).Error; err != nil {
+		return 0, err
+	}
+
+	count := identities + passkeys
+	if user.Password != "" {
+		count++
+	}
+	return count, nil
+}
+
+// removeUnprovenLoginMethods is called when a user who was never verified
+// proves they own their email address. Until then anyone could have created
+// the account through a provider that does not verify emails, so identities
+// without a verified email and passkeys added since are removed. It reports
+// whether anything was removed, in which case sessions should be revoked.
+func removeUnprovenLoginMethods(tx *gorm.DB, userID uint) (bool, error) {
+	identities := tx.Unscoped().Where("user_id = ? AND email_verified = ?", userID, false).Delete(&models.Identity{})
+	if identities.Error != nil {
+		return false, identities.Error
+	}
+	passkeys := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.WebAuthnCredential{})
+	if passkeys.Error != nil {
+		return false, passkeys.Error
+	}
+	return identities.RowsAffected+passkeys.RowsAffected > 0, nil
+}
+
+// providerDisplayName returns the name to show users for a provider
+func providerDisplayName(name string) string {
+	if provider, err := utils.GetOAuthProvider(name); err == nil {
+		return provider.DisplayName
+	}
+	return name
+}
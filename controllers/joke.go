@@ -1,13 +1,16 @@
 package controllers
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
+	"go-auth-app/jokegen"
 	"go-auth-app/models"
+	"go-auth-app/utils"
+	"log"
 	"net/http"
-	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -15,32 +18,57 @@ import (
 )
 
 type JokeRequest struct {
-	Prompt string `json:"prompt"`
+	Prompt    string   `json:"prompt"`
+	Languages []string `json:"languages"`
 }
 
 type JokeResponse struct {
-	English              []string `json:"english"`
-	Hindi                []string `json:"hindi"`
-	RemainingGenerations int      `json:"remaining_generations,omitempty"`
+	PromptID             uint                     `json:"prompt_id,omitempty"`
+	Jokes                map[string]LanguageJokes `json:"jokes"`
+	Error                string                   `json:"error,omitempty"`
+	RemainingGenerations int                      `json:"remaining_generations,omitempty"`
 }
 
-type OpenAIRequest struct {
-	Model       string    `json:"model"`
-	Messages    []Message `json:"messages"`
-	Temperature float64   `json:"temperature"`
+// LanguageJokes is the result for one language, with what a client needs to
+// render it
+type LanguageJokes struct {
+	Name      string   `json:"name"`
+	Script    string   `json:"script"`
+	Direction string   `json:"direction"`
+	Jokes     []string `json:"jokes"`
+	Error     string   `json:"error,omitempty"`
 }
 
-type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+// jokeGenerationTimeout bounds how long a request waits for every language.
+// Languages still running when it expires are reported as timed out.
+const jokeGenerationTimeout = 45 * time.Second
+
+var jokeGenerator jokegen.JokeGenerator
+
+var jokeLanguages = jokegen.DefaultLanguageSet()
+
+// SetJokeGenerator sets the model used by the joke endpoints
+func SetJokeGenerator(generator jokegen.JokeGenerator) {
+	jokeGenerator = generator
+}
+
+// SetJokeLanguages sets the languages the joke endpoints offer
+func SetJokeLanguages(languages jokegen.LanguageSet) {
+	jokeLanguages = languages
 }
 
-type OpenAIResponse struct {
-	Choices []struct {
-		Message struct {
-			Content string `json:"content"`
-		} `json:"message"`
-	} `json:"choices"`
+// ListJokeLanguages Function to list the languages jokes can be generated in
+func ListJokeLanguages(c *gin.Context) {
+	defaults := make([]string, len(jokeLanguages.Default))
+	for i, language := range jokeLanguages.Default {
+		defaults[i] = language.Code
+	}
+
+	c.JSON(200, gin.H{
+		"languages":       jokeLanguages.Allowed,
+		"default":         defaults,
+		"max_per_request": jokegen.MaxLanguagesPerRequest,
+	})
 }
 
 func GenerateJokes(c *gin.Context) {
@@ -50,6 +78,11 @@ func GenerateJokes(c *gin.Context) {
 		return
 	}
 
+	languages, ok := resolveJokeLanguages(c, request.Languages)
+	if !ok {
+		return
+	}
+
 	db, exists := c.Get("db")
 	if !exists || db == nil {
 		c.JSON(500, gin.H{"error": "Database not available"})
@@ -61,77 +94,115 @@ func GenerateJokes(c *gin.Context) {
 	userID, authenticated := c.Get("userID")
 
 	if !authenticated {
-		handleAnonymousJokeGeneration(c, request, dbConn)
+		handleAnonymousJokeGeneration(c, request, languages, dbConn)
+		return
+	}
+
+	handleAuthenticatedJokeGeneration(c, request, languages, dbConn, userID.(uint))
+}
+
+// resolveJokeLanguages validates the requested language tags against the
+// deployment's allow-list, falling back to the default languages
+func resolveJokeLanguages(c *gin.Context, tags []string) ([]jokegen.Language, bool) {
+	languages, err := jokeLanguages.Resolve(tags)
+	if err != nil {
+		allowed := make([]string, len(jokeLanguages.Allowed))
+		for i, language := range jokeLanguages.Allowed {
+			allowed[i] = language.Code
+		}
+		c.JSON(400, gin.H{"error": err.Error(), "supported_languages": allowed})
+		return nil, false
+	}
+	return languages, true
+}
+
+func handleAnonymousJokeGeneration(c *gin.Context, request JokeRequest, languages []jokegen.Language, db *gorm.DB) {
+	remaining, ok := consumeAnonymousGeneration(c, db)
+	if !ok {
 		return
 	}
 
-	handleAuthenticatedJokeGeneration(c, request, dbConn, userID.(uint))
+	response := jokeResponse(generateLanguages(c.Request.Context(), request.Prompt, languages))
+	response.RemainingGenerations = remaining
+
+	writeJokeResponse(c, response)
 }
 
-func handleAnonymousJokeGeneration(c *gin.Context, request JokeRequest, db *gorm.DB) {
+// Anonymous callers get anonymousGenerationLimit free generations a day per
+// X-Anonymous-Id. Since the ID is chosen by the client, every client IP is
+// also capped at anonymousIPGenerationLimit, leaving room for a few browsers
+// behind one NAT.
+const (
+	anonymousGenerationLimit   = 3
+	anonymousIPGenerationLimit = 10
+)
+
+// consumeAnonymousGeneration counts a generation against the caller's daily
+// free quota and returns how many are left. It responds and returns false
+// when the quota is used up. EventSource cannot set headers, so GET streams
+// may pass the ID in the anonymous_id query parameter.
+func consumeAnonymousGeneration(c *gin.Context, db *gorm.DB) (int, bool) {
 	anonymousID := c.GetHeader("X-Anonymous-Id")
+	if anonymousID == "" {
+		anonymousID = c.Query("anonymous_id")
+	}
 
 	if anonymousID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing anonymous ID"})
-		return
+		return 0, false
+	}
+	// Keep client IDs apart from the per-IP records
+	if strings.Contains(anonymousID, ":") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid anonymous ID"})
+		return 0, false
 	}
 
-	var anonymousGen models.AnonymousGeneration
-	result := db.Where("anonymous_id = ?", anonymousID).First(&anonymousGen)
+	byID, err := loadAnonymousGeneration(db, anonymousID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load anonymous generation record"})
+		return 0, false
+	}
+	byIP, err := loadAnonymousGeneration(db, utils.IPThrottleKey(c.ClientIP()))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load anonymous generation record"})
+		return 0, false
+	}
 
-	// If no record exists or it's been more than 24 hours since last generation
-	if result.Error == gorm.ErrRecordNotFound || time.Since(anonymousGen.LastGenerationTime) > 24*time.Hour {
-		anonymousGen = models.AnonymousGeneration{
-			AnonymousID:        anonymousID,
-			GenerationCount:    1,
-			LastGenerationTime: time.Now(),
-		}
-		if err := db.Create(&anonymousGen).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create anonymous generation record"})
-			return
-		}
-	} else {
-		// Check if generation limit is reached
-		if anonymousGen.GenerationCount >= 3 {
-			c.JSON(http.StatusForbidden, gin.H{
-				"error":                 "You have reached the maximum number of free generations. Please sign up to continue.",
-				"remaining_generations": 0,
-			})
-			return
-		}
+	if byID.GenerationCount >= anonymousGenerationLimit || byIP.GenerationCount >= anonymousIPGenerationLimit {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":                 "You have reached the maximum number of free generations. Please sign up to continue.",
+			"remaining_generations": 0,
+		})
+		return 0, false
+	}
 
+	for _, anonymousGen := range []*models.AnonymousGeneration{&byID, &byIP} {
 		anonymousGen.GenerationCount++
 		anonymousGen.LastGenerationTime = time.Now()
-		if err := db.Save(&anonymousGen).Error; err != nil {
+		if err := db.Save(anonymousGen).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update anonymous generation record"})
-			return
+			return 0, false
 		}
 	}
 
-	englishPrompt := fmt.Sprintf("Generate 5 funny jokes or puns based on these words: %s. Make them funny, creative, and humorous. Return only the jokes, one per line.", request.Prompt)
-	englishJokes, err := callOpenAI(englishPrompt)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate English jokes"})
-		return
-	}
+	return min(anonymousGenerationLimit-byID.GenerationCount, anonymousIPGenerationLimit-byIP.GenerationCount), true
+}
 
-	hindiPrompt := fmt.Sprintf("Generate 5 funny jokes or puns in Hindi (using Devanagari script) based on these words: %s. Make them funny, creative, and humorous. Return only the jokes, one per line.", request.Prompt)
-	hindiJokes, err := callOpenAI(hindiPrompt)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate Hindi jokes"})
-		return
+// loadAnonymousGeneration returns the generation count stored under key,
+// starting it over when the last generation was more than a day ago
+func loadAnonymousGeneration(db *gorm.DB, key string) (models.AnonymousGeneration, error) {
+	anonymousGen := models.AnonymousGeneration{AnonymousID: key}
+	err := db.Where("anonymous_id = ?", key).First(&anonymousGen).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return anonymousGen, err
 	}
-
-	response := JokeResponse{
-		English:              parseJokes(englishJokes),
-		Hindi:                parseJokes(hindiJokes),
-		RemainingGenerations: 3 - anonymousGen.GenerationCount,
+	if time.Since(anonymousGen.LastGenerationTime) > 24*time.Hour {
+		anonymousGen.GenerationCount = 0
 	}
-
-	c.JSON(http.StatusOK, response)
+	return anonymousGen, nil
 }
 
-func handleAuthenticatedJokeGeneration(c *gin.Context, request JokeRequest, db *gorm.DB, userID uint) {
+func handleAuthenticatedJokeGeneration(c *gin.Context, request JokeRequest, languages []jokegen.Language, db *gorm.DB, userID uint) {
 	// Save the prompt to the database
 	prompt := models.Prompt{
 		UserID: userID,
@@ -143,73 +214,148 @@ func handleAuthenticatedJokeGeneration(c *gin.Context, request JokeRequest, db *
 		return
 	}
 
-	englishPrompt := fmt.Sprintf("Generate 5 funny jokes or puns based on these words: %s. Make them funny, creative, and humorous. Return only the jokes, one per line.", request.Prompt)
-	englishJokes, err := callOpenAI(englishPrompt)
-	if err != nil {
-		c.JSON(500, gin.H{"error": "Failed to generate English jokes"})
-		return
+	results := generateLanguages(c.Request.Context(), request.Prompt, languages)
+	if err := saveJokes(db, prompt.ID, results); err != nil {
+		log.Printf("Failed to save jokes for prompt %d: %v", prompt.ID, err)
 	}
 
-	hindiPrompt := fmt.Sprintf("Generate 5 funny jokes or puns in Hindi (using Devanagari script) based on these words: %s. Make them funny, creative, and humorous. Return only the jokes, one per line.", request.Prompt)
-	hindiJokes, err := callOpenAI(hindiPrompt)
-	if err != nil {
-		c.JSON(500, gin.H{"error": "Failed to generate Hindi jokes"})
-		return
-	}
+	response := jokeResponse(results)
+	response.PromptID = prompt.ID
 
-	response := JokeResponse{
-		English: parseJokes(englishJokes),
-		Hindi:   parseJokes(hindiJokes),
-	}
-
-	c.JSON(200, response)
+	writeJokeResponse(c, response)
 }
 
-func callOpenAI(prompt string) (string, error) {
-	url := "https://api.openai.com/v1/chat/completions"
-	apiKey := os.Getenv("OPENAI_API_KEY")
+// languageResult is the outcome of generating jokes in one language
+type languageResult struct {
+	language   jokegen.Language
+	jokes      []string
+	completion jokegen.Completion
+	latency    time.Duration
+	failure    string
+}
 
-	request := OpenAIRequest{
-		Model: "gpt-4o",
-		Messages: []Message{
-			{
-				Role:    "user",
-				Content: prompt,
-			},
-		},
-		Temperature: 0.7,
+// generateLanguages generates the jokes for every language concurrently. A
+// language that fails is reported in its result without discarding the
+// others. Cancelling ctx, as net/http does when the client disconnects,
+// cancels the upstream calls.
+func generateLanguages(ctx context.Context, words string, languages []jokegen.Language) []languageResult {
+	ctx, cancel := context.WithTimeout(ctx, jokeGenerationTimeout)
+	defer cancel()
+
+	results := make([]languageResult, len(languages))
+
+	var wg sync.WaitGroup
+	for i, language := range languages {
+		wg.Add(1)
+		go func(i int, language jokegen.Language) {
+			defer wg.Done()
+			results[i] = generateLanguage(ctx, language, words)
+		}(i, language)
 	}
+	wg.Wait()
 
-	jsonData, err := json.Marshal(request)
+	return results
+}
+
+// generateLanguage generates the jokes for one language
+func generateLanguage(ctx context.Context, language jokegen.Language, words string) languageResult {
+	result := languageResult{language: language}
+
+	start := time.Now()
+	completion, err := generateJokeText(ctx, language.PromptFor(words))
+	result.latency = time.Since(start)
 	if err != nil {
-		return "", err
+		result.failure = jokeErrorMessage(language.Name, err)
+		return result
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", err
+	result.jokes = parseJokes(completion.Text)
+	result.completion = completion
+	return result
+}
+
+// jokeResponse builds the response body keyed by language code
+func jokeResponse(results []languageResult) JokeResponse {
+	response := JokeResponse{Jokes: make(map[string]LanguageJokes, len(results))}
+	for _, result := range results {
+		response.Jokes[result.language.Code] = LanguageJokes{
+			Name:      result.language.Name,
+			Script:    result.language.Script,
+			Direction: result.language.Direction,
+			Jokes:     result.jokes,
+			Error:     result.failure,
+		}
 	}
+	return response
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
+// saveJokes stores the generated jokes with the prompt they were generated for
+func saveJokes(db *gorm.DB, promptID uint, results []languageResult) error {
+	var jokes []models.Joke
+	for _, result := range results {
+		for position, text := range result.jokes {
+			jokes = append(jokes, models.Joke{
+				PromptID:     promptID,
+				Language:     result.language.Code,
+				Position:     position,
+				Text:         text,
+				Provider:     result.completion.Provider,
+				ModelName:    result.completion.Model,
+				InputTokens:  result.completion.InputTokens,
+				OutputTokens: result.completion.OutputTokens,
+				LatencyMS:    result.latency.Milliseconds(),
+			})
+		}
+	}
+	if len(jokes) == 0 {
+		return nil
+	}
+	return db.Create(&jokes).Error
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
+// jokeErrorMessage describes a failed generation for the client, logging
+// failures that are not simply a timeout or a disconnect
+func jokeErrorMessage(language string, err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Sprintf("Timed out generating %s jokes", language)
+	case errors.Is(err, context.Canceled):
+		return fmt.Sprintf("Generating %s jokes was cancelled", language)
+	default:
+		log.Printf("Failed to generate %s jokes: %v", language, err)
+		return fmt.Sprintf("Failed to generate %s jokes", language)
 	}
-	defer resp.Body.Close()
+}
 
-	var openAIResp OpenAIResponse
-	if err := json.NewDecoder(resp.Body).Decode(&openAIResp); err != nil {
-		return "", err
+// writeJokeResponse sends the jokes, failing the request only when no
+// language succeeded
+func writeJokeResponse(c *gin.Context, response JokeResponse) {
+	if c.Request.Context().Err() != nil {
+		// The client has gone away
+		return
 	}
 
-	if len(openAIResp.Choices) == 0 {
-		return "", fmt.Errorf("no response from OpenAI")
+	failed := true
+	for _, result := range response.Jokes {
+		if result.Error == "" {
+			failed = false
+		}
+	}
+	if failed {
+		response.Error = "Failed to generate jokes"
+		c.JSON(http.StatusBadGateway, response)
+		return
 	}
 
-	return openAIResp.Choices[0].Message.Content, nil
+	c.JSON(http.StatusOK, response)
+}
+
+// generateJokeText asks the configured model to complete the prompt
+func generateJokeText(ctx context.Context, prompt string) (jokegen.Completion, error) {
+	if jokeGenerator == nil {
+		return jokegen.Completion{}, errors.New("no joke generator configured")
+	}
+	return jokeGenerator.Generate(ctx, prompt)
 }
 
 func parseJokes(jokesString string) []string {
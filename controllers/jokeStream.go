@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"go-auth-app/jokegen"
+	"go-auth-app/models"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// jokeEvent is one server-sent event of a streamed generation
+type jokeEvent struct {
+	name string
+	data gin.H
+}
+
+// GenerateJokesStream Function to stream jokes as server-sent events while the
+// model writes them. A "languages" event first describes the script and
+// direction of each language. Every completed joke is then sent as a "joke"
+// event tagged with its language code, a language that fails is reported with
+// an "error" event, and a final "done" event carries the remaining quota. GET
+// requests, as sent by EventSource, pass the prompt and a comma separated
+// languages list in the query.
+func GenerateJokesStream(c *gin.Context) {
+	var request JokeRequest
+	if c.Request.Method == "GET" {
+		request.Prompt = c.Query("prompt")
+		for _, value := range c.QueryArray("languages") {
+			request.Languages = append(request.Languages, strings.Split(value, ",")...)
+		}
+	} else if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+	if strings.TrimSpace(request.Prompt) == "" {
+		c.JSON(400, gin.H{"error": "Prompt is required"})
+		return
+	}
+
+	languages, ok := resolveJokeLanguages(c, request.Languages)
+	if !ok {
+		return
+	}
+
+	db, exists := c.Get("db")
+	if !exists || db == nil {
+		c.JSON(500, gin.H{"error": "Database not available"})
+		return
+	}
+	dbConn := db.(*gorm.DB)
+
+	done := gin.H{}
+	var finish func([]languageResult)
+	if userID, authenticated := c.Get("userID"); authenticated {
+		prompt := models.Prompt{UserID: userID.(uint), Text: request.Prompt}
+		if err := dbConn.Create(&prompt).Error; err != nil {
+			c.JSON(500, gin.H{"error": "Failed to save the prompt"})
+			return
+		}
+		done["prompt_id"] = prompt.ID
+		finish = func(results []languageResult) {
+			if err := saveJokes(dbConn, prompt.ID, results); err != nil {
+				log.Printf("Failed to save jokes for prompt %d: %v", prompt.ID, err)
+			}
+		}
+	} else {
+		remaining, ok := consumeAnonymousGeneration(c, dbConn)
+		if !ok {
+			return
+		}
+		done["remaining_generations"] = remaining
+	}
+
+	events := make(chan jokeEvent)
+	go streamJokeLanguages(c.Request.Context(), request.Prompt, languages, events, finish)
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent("languages", gin.H{"languages": languages})
+	c.Stream(func(w io.Writer) bool {
+		event, ok := <-events
+		if !ok {
+			c.SSEvent("done", done)
+			return false
+		}
+		c.SSEvent(event.name, event.data)
+		return true
+	})
+}
+
+// streamJokeLanguages generates every language concurrently, sending events
+// as jokes complete. When all languages have finished it passes the results
+// to finish, if set, and closes events. Only the upstream calls are bounded by
+// jokeGenerationTimeout, so the error events of languages that time out are
+// still delivered. Sends give up once ctx, the request context, is done so no
+// goroutine outlives a disconnect.
+func streamJokeLanguages(ctx context.Context, words string, languages []jokegen.Language, events chan<- jokeEvent, finish func([]languageResult)) {
+	generateCtx, cancel := context.WithTimeout(ctx, jokeGenerationTimeout)
+	defer cancel()
+
+	send := func(event jokeEvent) {
+		select {
+		case events <- event:
+		case <-ctx.Done():
+		}
+	}
+
+	results := make([]languageResult, len(languages))
+
+	var wg sync.WaitGroup
+	for i, language := range languages {
+		results[i].language = language
+
+		wg.Add(1)
+		go func(result *languageResult) {
+			defer wg.Done()
+
+			language := result.language
+			emit := func(line string) {
+				if joke := strings.TrimSpace(line); joke != "" {
+					send(jokeEvent{"joke", gin.H{"language": language.Code, "index": len(result.jokes), "joke": joke}})
+					result.jokes = append(result.jokes, joke)
+				}
+			}
+
+			var pending strings.Builder
+			start := time.Now()
+			completion, err := streamJokeText(generateCtx, language.PromptFor(words), func(text string) {
+				pending.WriteString(text)
+				lines := strings.Split(pending.String(), "\n")
+				for _, line := range lines[:len(lines)-1] {
+					emit(line)
+				}
+				pending.Reset()
+				pending.WriteString(lines[len(lines)-1])
+			})
+			result.latency = time.Since(start)
+			if err != nil {
+				result.failure = jokeErrorMessage(language.Name, err)
+				send(jokeEvent{"error", gin.H{"language": language.Code, "error": result.failure}})
+				return
+			}
+			emit(pending.String())
+			result.completion = completion
+		}(&results[i])
+	}
+
+	wg.Wait()
+	if finish != nil {
+		finish(results)
+	}
+	close(events)
+}
+
+// streamJokeText asks the configured model to complete the prompt, passing
+// text to onText as the model produces it
+func streamJokeText(ctx context.Context, prompt string, onText func(string)) (jokegen.Completion, error) {
+	if jokeGenerator == nil {
+		return jokegen.Completion{}, errors.New("no joke generator configured")
+	}
+	return jokegen.Stream(ctx, jokeGenerator, prompt, onText)
+}
@@ -0,0 +1,258 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-auth-app/jokegen"
+	"go-auth-app/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// useJokeGenerator serves the joke endpoints from generator
+func useJokeGenerator(t *testing.T, generator jokegen.JokeGenerator) {
+	t.Helper()
+	previous := jokeGenerator
+	jokeGenerator = generator
+	t.Cleanup(func() { jokeGenerator = previous })
+}
+
+func withDB(c *gin.Context) {
+	c.Set("db", models.DB)
+	c.Next()
+}
+
+// generateAnonymously posts a joke request from clientIP with the given
+// anonymous ID
+func generateAnonymously(t *testing.T, r *gin.Engine, anonymousID, clientIP string) (int, gin.H) {
+	t.Helper()
+	data, _ := json.Marshal(gin.H{"prompt": "cats", "languages": []string{"en"}})
+	req := httptest.NewRequest(http.MethodPost, "/generate-jokes", bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = clientIP + ":1234"
+	if anonymousID != "" {
+		req.Header.Set("X-Anonymous-Id", anonymousID)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var response gin.H
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode response %q: %v", w.Body.String(), err)
+	}
+	return w.Code, response
+}
+
+func TestAnonymousQuota(t *testing.T) {
+	setupTestDB(t)
+	useJokeGenerator(t, jokegen.NewFake())
+
+	r := gin.New()
+	r.POST("/generate-jokes", withDB, GenerateJokes)
+
+	if status, response := generateAnonymously(t, r, "", "192.0.2.1"); status != 400 {
+		t.Fatalf("without an anonymous ID: %d %v, want 400", status, response)
+	}
+	if status, response := generateAnonymously(t, r, "ip:192.0.2.1", "192.0.2.1"); status != 400 {
+		t.Fatalf("with an IP key as anonymous ID: %d %v, want 400", status, response)
+	}
+
+	// Each anonymous ID gets its own daily quota
+	for i := 1; i <= anonymousGenerationLimit; i++ {
+		status, response := generateAnonymously(t, r, "first", "192.0.2.1")
+		remaining, _ := response["remaining_generations"].(float64) // omitted when zero
+		if status != 200 || int(remaining) != anonymousGenerationLimit-i {
+			t.Fatalf("generation %d: %d %v", i, status, response)
+		}
+	}
+	if status, response := generateAnonymously(t, r, "first", "192.0.2.1"); status != 403 {
+		t.Fatalf("past the quota: %d %v, want 403", status, response)
+	}
+	if status, response := generateAnonymously(t, r, "first", "192.0.2.2"); status != 403 {
+		t.Fatalf("same ID from another IP: %d %v, want 403", status, response)
+	}
+
+	// Fresh IDs from one IP run into the per-IP cap
+	for i := anonymousGenerationLimit; i < anonymousIPGenerationLimit; i++ {
+		if status, response := generateAnonymously(t, r, fmt.Sprintf("rotated-%d", i), "192.0.2.1"); status != 200 {
+			t.Fatalf("generation %d from the IP: %d %v", i+1, status, response)
+		}
+	}
+	if status, response := generateAnonymously(t, r, "rotated-last", "192.0.2.1"); status != 403 {
+		t.Fatalf("past the IP cap: %d %v, want 403", status, response)
+	}
+	if status, response := generateAnonymously(t, r, "rotated-last", "192.0.2.2"); status != 200 {
+		t.Fatalf("fresh ID from another IP: %d %v", status, response)
+	}
+}
+
+// hindiFails is the fake generator except that Hindi jokes fail. It does not
+// stream, so streamed jokes arrive in one piece.
+type hindiFails struct {
+	fake *jokegen.Fake
+}
+
+func (g hindiFails) Generate(ctx context.Context, prompt string) (jokegen.Completion, error) {
+	if strings.Contains(prompt, "Hindi") {
+		return jokegen.Completion{}, errors.New("model unavailable")
+	}
+	return g.fake.Generate(ctx, prompt)
+}
+
+func jokeRouter(user models.User) *gin.Engine {
+	r := gin.New()
+	r.POST("/generate-jokes", withDB, signedInAs(user), GenerateJokes)
+	r.POST("/generate-jokes/stream", withDB, signedInAs(user), GenerateJokesStream)
+	return r
+}
+
+func TestGenerateJokes(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "jokes@example.com", models.RoleUser)
+	fake := &jokegen.Fake{Jokes: []string{"First joke", "", "  Second joke  "}}
+	useJokeGenerator(t, fake)
+	r := jokeRouter(user)
+
+	status, response := postJSON(t, r, "/generate-jokes", gin.H{"prompt": "cats", "languages": []string{"hi", "en-GB"}})
+	if status != 200 || response["prompt_id"] == nil {
+		t.Fatalf("generate: %d %v", status, response)
+	}
+	jokes := response["jokes"].(map[string]interface{})
+	hindi, _ := jokes["hi"].(map[string]interface{})
+	english, _ := jokes["en"].(map[string]interface{})
+	if len(jokes) != 2 || hindi["script"] != "Deva" || english["name"] != "English" {
+		t.Fatalf("jokes = %v, want Hindi and English", jokes)
+	}
+	if fmt.Sprint(english["jokes"]) != "[First joke Second joke]" {
+		t.Errorf("english jokes = %v", english["jokes"])
+	}
+
+	var saved []models.Joke
+	models.DB.Where("prompt_id = ?", response["prompt_id"]).Order("language, position").Find(&saved)
+	if len(saved) != 4 || saved[0].Language != "en" || saved[0].Text != "First joke" || saved[0].Provider != jokegen.ProviderFake {
+		t.Fatalf("saved jokes = %+v", saved)
+	}
+
+	status, response = postJSON(t, r, "/generate-jokes", gin.H{"prompt": "cats", "languages": []string{"xx"}})
+	if status != 400 || response["supported_languages"] == nil {
+		t.Fatalf("unsupported language: %d %v, want 400", status, response)
+	}
+
+	// One language failing keeps the others
+	useJokeGenerator(t, hindiFails{fake})
+	status, response = postJSON(t, r, "/generate-jokes", gin.H{"prompt": "cats", "languages": []string{"en", "hi"}})
+	jokes = response["jokes"].(map[string]interface{})
+	if status != 200 || jokes["hi"].(map[string]interface{})["error"] != "Failed to generate Hindi jokes" || jokes["en"].(map[string]interface{})["error"] != nil {
+		t.Fatalf("partial failure: %d %v", status, response)
+	}
+
+	fake.Err = errors.New("model unavailable")
+	useJokeGenerator(t, fake)
+	status, response = postJSON(t, r, "/generate-jokes", gin.H{"prompt": "cats"})
+	if status != 502 || response["error"] != "Failed to generate jokes" {
+		t.Fatalf("every language failing: %d %v, want 502", status, response)
+	}
+}
+
+// streamRecorder is a ResponseRecorder gin can stream to, which needs a
+// CloseNotifier
+type streamRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (streamRecorder) CloseNotify() <-chan bool {
+	return make(chan bool)
+}
+
+type sseEvent struct {
+	name string
+	data map[string]interface{}
+}
+
+// streamJokes posts to the stream endpoint and returns its events in order
+func streamJokes(t *testing.T, r *gin.Engine, body gin.H) []sseEvent {
+	t.Helper()
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/generate-jokes/stream", bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	w := streamRecorder{httptest.NewRecorder()}
+	r.ServeHTTP(w, req)
+	if w.Code != 200 || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("stream: %d %s", w.Code, w.Body.String())
+	}
+
+	var events []sseEvent
+	for _, block := range strings.Split(strings.TrimSpace(w.Body.String()), "\n\n") {
+		var event sseEvent
+		for _, line := range strings.Split(block, "\n") {
+			if name, ok := strings.CutPrefix(line, "event:"); ok {
+				event.name = name
+			} else if payload, ok := strings.CutPrefix(line, "data:"); ok {
+				if err := json.Unmarshal([]byte(payload), &event.data); err != nil {
+					t.Fatalf("event data %q: %v", payload, err)
+				}
+			}
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestGenerateJokesStream(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "stream@example.com", models.RoleUser)
+	useJokeGenerator(t, hindiFails{&jokegen.Fake{Jokes: []string{"First joke", "Second joke"}}})
+	r := jokeRouter(user)
+
+	events := streamJokes(t, r, gin.H{"prompt": "cats", "languages": []string{"en", "hi"}})
+	if len(events) < 2 || events[0].name != "languages" || events[len(events)-1].name != "done" {
+		t.Fatalf("events = %v, want languages first and done last", events)
+	}
+
+	var english []string
+	var failures []interface{}
+	for _, event := range events[1 : len(events)-1] {
+		switch event.name {
+		case "joke":
+			if event.data["language"] != "en" || event.data["index"] != float64(len(english)) {
+				t.Errorf("joke event = %v", event.data)
+			}
+			english = append(english, event.data["joke"].(string))
+		case "error":
+			failures = append(failures, event.data["language"], event.data["error"])
+		default:
+			t.Errorf("unexpected %s event", event.name)
+		}
+	}
+	if fmt.Sprint(english) != "[First joke Second joke]" || fmt.Sprint(failures) != "[hi Failed to generate Hindi jokes]" {
+		t.Fatalf("jokes = %v, errors = %v", english, failures)
+	}
+
+	promptID := events[len(events)-1].data["prompt_id"]
+	var saved int64
+	models.DB.Model(&models.Joke{}).Where("prompt_id = ? AND language = ?", promptID, "en").Count(&saved)
+	if promptID == nil || saved != 2 {
+		t.Fatalf("prompt %v has %d saved jokes, want 2", promptID, saved)
+	}
+
+	// The fake generator streams line by line, like a model would
+	useJokeGenerator(t, jokegen.NewFake())
+	events = streamJokes(t, r, gin.H{"prompt": "dogs", "languages": []string{"hi"}})
+	languages := events[0].data["languages"].([]interface{})
+	if len(events) != 7 || languages[0].(map[string]interface{})["script"] != "Deva" {
+		t.Fatalf("events = %v, want the Hindi language, five jokes and done", events)
+	}
+	for i, event := range events[1:6] {
+		if event.name != "joke" || event.data["index"] != float64(i) || !strings.HasPrefix(event.data["joke"].(string), fmt.Sprintf("Fake joke %d ", i+1)) {
+			t.Errorf("event %d = %s %v", i+1, event.name, event.data)
+		}
+	}
+}
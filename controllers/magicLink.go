@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"fmt"
+	"go-auth-app/models"
+	"go-auth-app/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const magicLinkTTL = 15 * time.Minute
+
+// RequestMagicLink Function to email a one-time login link
+func RequestMagicLink(c *gin.Context) {
+	var request struct {
+		Email string `json:"email" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	// Respond identically whether or not the account exists
+	response := gin.H{"success": "If an account exists for that email, a sign-in link has been sent."}
+
+	var user models.User
+	models.DB.Where("email = ?", request.Email).First(&user)
+	if user.ID == 0 {
+		c.JSON(200, response)
+		return
+	}
+
+	token, err := utils.CreateEmailToken(user.ID, models.EmailTokenMagicLink, magicLinkTTL)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to create login link"})
+		return
+	}
+
+	data := map[string]string{
+		"LoginLink": fmt.Sprintf("%s/magic-login?token=%s", utils.FrontendURL(), token),
+		"ExpiresIn": "15 minutes",
+	}
+	templatePath := "templates/magic_link_template.html"
+	sendEmail(user.Email, "Your JokeMaster Sign-In Link", templatePath, data)
+	c.JSON(200, response)
+}
+
+// MagicLinkLogin Function to exchange a magic link token for a session
+func MagicLinkLogin(c *gin.Context) {
+	var request struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	emailToken, err := utils.ConsumeEmailToken(request.Token, models.EmailTokenMagicLink)
+	if err != nil {
+		c.JSON(401, gin.H{"error": "Invalid or expired login link"})
+		return
+	}
+
+	var user models.User
+	if err := models.DB.First(&user, emailToken.UserID).Error; err != nil {
+		c.JSON(401, gin.H{"error": "Invalid or expired login link"})
+		return
+	}
+
+	// Receiving the link proves ownership of the address. Whoever signed up
+	// with it before may not own it, so the password and other login methods
+	// they set up are removed and their sessions are ended.
+	if !user.IsVerified {
+		err := models.DB.Transaction(func(tx *gorm.DB) error {
+			if _, err := removeUnprovenLoginMethods(tx, user.ID); err != nil {
+				return err
+			}
+			if err := tx.Model(&user).Updates(map[string]interface{}{
+				"password":    "",
+				"is_verified": true,
+			}).Error; err != nil {
+				return err
+			}
+			return utils.RevokeUserAccess(tx, user.ID)
+		})
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to verify email"})
+			return
+		}
+		user.Password = ""
+		user.IsVerified = true
+	}
+
+	completeLogin(c, user, models.AuthMethodMagicLink)
+}
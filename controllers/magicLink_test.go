@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"go-auth-app/models"
+	"go-auth-app/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMagicLinkRemovesPasswordOfUnverifiedSignup(t *testing.T) {
+	setupTestDB(t)
+
+	// Someone signed up with the victim's address and a password of their own
+	hash, err := utils.GenerateHashPassword("attacker-password-1")
+	if err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+	user := models.User{Email: "victim@example.com", Password: hash}
+	if err := models.DB.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	session, err := utils.StartSession(user.ID, models.AuthMethodPassword, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("start session: %v", err)
+	}
+
+	token, err := utils.CreateEmailToken(user.ID, models.EmailTokenMagicLink, time.Minute)
+	if err != nil {
+		t.Fatalf("create magic link: %v", err)
+	}
+
+	r := gin.New()
+	r.POST("/login/magic-link/verify", MagicLinkLogin)
+	r.POST("/login", Login)
+
+	status, response := postJSON(t, r, "/login/magic-link/verify", gin.H{"token": token})
+	if status != 200 || response["access_token"] == nil {
+		t.Fatalf("magic link login: %d %v", status, response)
+	}
+	if _, err := utils.ParseJWT(response["access_token"].(string)); err != nil {
+		t.Fatalf("access token from the magic link login was rejected: %v", err)
+	}
+
+	status, response = postJSON(t, r, "/login", gin.H{"email": user.Email, "password": "attacker-password-1"})
+	if status != 401 {
+		t.Fatalf("login with the pre-set password: %d %v, want 401", status, response)
+	}
+
+	var stored models.User
+	models.DB.First(&stored, user.ID)
+	if !stored.IsVerified || stored.Password != "" {
+		t.Fatalf("verified = %v, password set = %v; want verified without a password", stored.IsVerified, stored.Password != "")
+	}
+
+	var old models.Session
+	models.DB.First(&old, session.ID)
+	if old.RevokedAt == nil {
+		t.Fatal("session from before the magic link login was not revoked")
+	}
+}
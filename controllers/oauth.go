@@ -0,0 +1,336 @@
+package controllers
+
+import (
+	"errors"
+	"go-auth-app/models"
+	"go-auth-app/utils"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const oauthStateCookie = "oauth_state"
+
+var (
+	errIdentityInUse   = errors.New("identity is linked to another user")
+	errUnverifiedEmail = errors.New("provider has not verified the email address")
+)
+
+// ListOAuthProviders Function to list the login providers the frontend can offer
+func ListOAuthProviders(c *gin.Context) {
+	providers := []gin.H{}
+	for _, name := range utils.OAuthProviderNames() {
+		provider, _ := utils.GetOAuthProvider(name)
+		providers = append(providers, gin.H{
+			"name":         provider.Name,
+			"display_name": provider.DisplayName,
+			"login_url":    "/auth/" + url.PathEscape(provider.Name),
+		})
+	}
+
+	c.JSON(200, gin.H{"providers": providers})
+}
+
+// OAuthLogin Function to start a login with an external provider. With the
+// link_token from StartIdentityLink the provider account is linked to the
+// signed-in user instead. The callback only accepts the state cookie set
+// here, so the whole flow stays in the browser that started it.
+func OAuthLogin(c *gin.Context) {
+	provider, err := utils.GetOAuthProvider(c.Param("provider"))
+	if err != nil {
+		c.JSON(404, gin.H{"error": "Unknown login provider"})
+		return
+	}
+
+	redirectTo, err := utils.SafeRedirectPath(c.Query("redirect_to"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	state, err := utils.NewOAuthState(provider.Name, redirectTo)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to generate state"})
+		return
+	}
+
+	if linkToken := c.Query("link_token"); linkToken != "" {
+		authCode, err := utils.ConsumeAuthCode(linkToken, models.AuthCodeIdentityLink)
+		if err != nil {
+			c.JSON(401, gin.H{"error": "Invalid or expired link request"})
+			return
+		}
+		state.LinkUserID = authCode.UserID
+	}
+
+	authURL, err := provider.AuthCodeURL(c.Request.Context(), state.State, state.Nonce, state.Verifier)
+	if err != nil {
+		log.Printf("Failed to start %s login: %v", provider.Name, err)
+		c.JSON(502, gin.H{"error": "Login provider is unavailable"})
+		return
+	}
+
+	cookie, err := utils.SignOAuthState(state)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to generate state"})
+		return
+	}
+
+	setOAuthCookie(c, oauthStateCookie, cookie, int(utils.OAuthStateTTL.Seconds()))
+	c.Redirect(302, authURL)
+}
+
+// OAuthCallback Function to finish a login with an external provider
+func OAuthCallback(c *gin.Context) {
+	provider, err := utils.GetOAuthProvider(c.Param("provider"))
+	if err != nil {
+		c.JSON(404, gin.H{"error": "Unknown login provider"})
+		return
+	}
+
+	// The state cookie is single use whatever the outcome
+	cookie, _ := c.Cookie(oauthStateCookie)
+	setOAuthCookie(c, oauthStateCookie, "", -1)
+
+	state, err := utils.VerifyOAuthState(cookie, provider.Name, c.Query("state"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid or expired login attempt, please try again"})
+		return
+	}
+
+	code := c.Query("code")
+	if code == "" {
+		c.JSON(400, gin.H{"error": "Code not found"})
+		return
+	}
+
+	identity, err := provider.Exchange(c.Request.Context(), code, state.Nonce, state.Verifier)
+	if err != nil {
+		log.Printf("Failed to complete %s login: %v", provider.Name, err)
+		c.JSON(401, gin.H{"error": "Failed to verify login with provider"})
+		return
+	}
+
+	if state.LinkUserID != 0 {
+		linkIdentityToUser(c, state, identity)
+		return
+	}
+
+	user, needsConfirmation, err := findOrCreateOAuthUser(identity)
+	if errors.Is(err, errUnverifiedEmail) {
+		c.JSON(403, gin.H{"error": "Please verify your email address with " + provider.DisplayName + " before signing up"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	// The email matches an account we cannot link automatically. Hand the
+	// frontend a token it can use to ask the owner for confirmation.
+	if needsConfirmation {
+		linkToken, err := utils.CreatePendingLink(user.ID, identity)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to start account linking"})
+			return
+		}
+
+		query := url.Values{}
+		query.Set("link_token", linkToken)
+		query.Set("provider", provider.Name)
+		query.Set("has_password", strconv.FormatBool(user.Password != ""))
+		c.Redirect(302, frontendURL("/auth/link", query))
+		return
+	}
+
+	if !user.IsVerified {
+		c.JSON(403, gin.H{"error": "Please verify your email address before logging in"})
+		return
+	}
+
+	// Tokens never go in the URL. The frontend exchanges this code for them
+	// at /auth/exchange.
+	authCode, err := utils.CreateAuthCode(user.ID, models.AuthCodeLogin, provider.Name, utils.AuthCodeTTL)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to create login code"})
+		return
+	}
+
+	query := url.Values{}
+	query.Set("code", authCode)
+	if state.RedirectTo != "" {
+		query.Set("redirect_to", state.RedirectTo)
+	}
+
+	c.Redirect(302, frontendURL("/auth/"+url.PathEscape(provider.Name)+"/callback", query))
+}
+
+// ExchangeAuthCode Function to trade the one-time code from a provider login
+// redirect for tokens
+func ExchangeAuthCode(c *gin.Context) {
+	var request struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	authCode, err := utils.ConsumeAuthCode(request.Code, models.AuthCodeLogin)
+	if err != nil {
+		c.JSON(401, gin.H{"error": "Invalid or expired code"})
+		return
+	}
+
+	var user models.User
+	if err := models.DB.First(&user, authCode.UserID).Error; err != nil {
+		c.JSON(401, gin.H{"error": "Invalid or expired code"})
+		return
+	}
+
+	completeLogin(c, user, authCode.AuthMethod)
+}
+
+// linkIdentityToUser finishes a provider login started by StartIdentityLink.
+// Whoever opened the link URL logged in with the provider, so the identity is
+// held until the signed-in user claims it with CompleteIdentityLink.
+func linkIdentityToUser(c *gin.Context, state *utils.OAuthState, identity *utils.ExternalIdentity) {
+	linkToken, err := utils.CreateSignedInLink(state.LinkUserID, identity)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to link account"})
+		return
+	}
+
+	query := url.Values{}
+	query.Set("link_token", linkToken)
+	query.Set("provider", identity.Provider)
+	if state.RedirectTo != "" {
+		query.Set("redirect_to", state.RedirectTo)
+	}
+	c.Redirect(302, frontendURL("/auth/link/complete", query))
+}
+
+// findOrCreateOAuthUser returns the user linked to the external identity,
+// creating the user and identity on first login. An existing account with the
+// same email is only linked automatically when both the provider and this
+// service have verified the address; otherwise the returned flag asks the
+// caller to get the account owner's confirmation first. No account is created
+// for an address the provider has not verified, so nobody can claim someone
+// else's email before they sign up.
+func findOrCreateOAuthUser(external *utils.ExternalIdentity) (models.User, bool, error) {
+	var user models.User
+	needsConfirmation := false
+	now := time.Now()
+
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		var identity models.Identity
+		err := tx.Where("provider = ? AND subject = ?", external.Provider, external.Subject).First(&identity).Error
+		if err == nil {
+			if err := tx.First(&user, identity.UserID).Error; err != nil {
+				return err
+			}
+			return tx.Model(&identity).Updates(map[string]interface{}{
+				"email":          external.Email,
+				"email_verified": external.EmailVerified,
+				"name":           external.Name,
+				"image_url":      external.Picture,
+				"last_login_at":  now,
+			}).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		err = tx.Where("email = ?", external.Email).First(&user).Error
+		switch {
+		case err == nil:
+			if !external.EmailVerified || !user.IsVerified {
+				needsConfirmation = true
+				return nil
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if !external.EmailVerified {
+				return errUnverifiedEmail
+			}
+			user = models.User{
+				Name:       external.Name,
+				Email:      external.Email,
+				IsVerified: true,
+				ImageURL:   external.Picture,
+				Prompts:    []models.Prompt{},
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		return createIdentity(tx, user.ID, external)
+	})
+
+	return user, needsConfirmation, err
+}
+
+// createIdentity links an external identity to a user. Linking an identity
+// that already belongs to another user fails with errIdentityInUse.
+func createIdentity(tx *gorm.DB, userID uint, external *utils.ExternalIdentity) error {
+	var existing models.Identity
+	err := tx.Where("provider = ? AND subject = ?", external.Provider, external.Subject).First(&existing).Error
+	if err == nil {
+		if existing.UserID != userID {
+			return errIdentityInUse
+		}
+		return nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	now := time.Now()
+	return tx.Create(&models.Identity{
+		UserID:        userID,
+		Provider:      external.Provider,
+		Subject:       external.Subject,
+		Email:         external.Email,
+		EmailVerified: external.EmailVerified,
+		Name:          external.Name,
+		ImageURL:      external.Picture,
+		LastLoginAt:   &now,
+	}).Error
+}
+
+// frontendURL builds a URL on the frontend from a path that may already
+// carry a query string.
+func frontendURL(path string, query url.Values) string {
+	target, err := url.Parse(path)
+	if err != nil {
+		target = &url.URL{Path: "/"}
+	}
+
+	values := target.Query()
+	for key, value := range query {
+		values[key] = value
+	}
+	target.RawQuery = values.Encode()
+
+	return utils.FrontendURL() + target.String()
+}
+
+// setOAuthCookie stores short-lived login state scoped to the /auth routes.
+// maxAge is in seconds; a negative maxAge deletes the cookie.
+func setOAuthCookie(c *gin.Context, name, value string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(name, value, maxAge, "/auth", "", isSecureRequest(c), true)
+}
+
+// isSecureRequest reports whether the client reached us over HTTPS, either
+// directly or through App Engine's TLS-terminating proxy.
+func isSecureRequest(c *gin.Context) bool {
+	return c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+}
@@ -0,0 +1,261 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-auth-app/models"
+	"go-auth-app/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestOAuthCallbackExpiresStateCookie(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.GET("/auth/:provider/callback", OAuthCallback)
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/google/callback?state=forged&code=code", nil)
+	req.AddCookie(&http.Cookie{Name: oauthStateCookie, Value: "stale"})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != 400 {
+		t.Fatalf("status = %d, want 400: %s", w.Code, w.Body.String())
+	}
+
+	for _, header := range w.Header().Values("Set-Cookie") {
+		if strings.HasPrefix(header, oauthStateCookie+"=") {
+			if !strings.Contains(header, "Max-Age=0") {
+				t.Fatalf("state cookie is not expired: %s", header)
+			}
+			return
+		}
+	}
+	t.Fatal("callback did not clear the state cookie")
+}
+
+// fakeOIDC is an OpenID provider serving discovery, keys and a token
+// endpoint. Users "log in" with login, which hands out an authorization code.
+type fakeOIDC struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu     sync.Mutex
+	logins map[string]jwt.MapClaims
+}
+
+const fakeOIDCClientID = "fake-client"
+
+func newFakeOIDC() *fakeOIDC {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	provider := &fakeOIDC{key: key, logins: make(map[string]jwt.MapClaims)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                 provider.server.URL,
+			"authorization_endpoint": provider.server.URL + "/authorize",
+			"token_endpoint":         provider.server.URL + "/token",
+			"jwks_uri":               provider.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": "test",
+				"n":   b64.EncodeToString(key.N.Bytes()),
+				"e":   b64.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		provider.mu.Lock()
+		claims, ok := provider.logins[r.FormValue("code")]
+		delete(provider.logins, r.FormValue("code"))
+		provider.mu.Unlock()
+		if !ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(400)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "test"
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idToken,
+		})
+	})
+	provider.server = httptest.NewServer(mux)
+	return provider
+}
+
+// login signs the user in at the authorization URL our server redirected to
+// and returns the callback query the provider would send them back with
+func (p *fakeOIDC) login(t *testing.T, authURL, subject, email string) url.Values {
+	t.Helper()
+	parsed, err := url.Parse(authURL)
+	if err != nil || !strings.HasPrefix(authURL, p.server.URL+"/authorize") {
+		t.Fatalf("not redirected to the provider: %s", authURL)
+	}
+	query := parsed.Query()
+	if query.Get("client_id") != fakeOIDCClientID || query.Get("code_challenge") == "" {
+		t.Fatalf("authorization request = %v", query)
+	}
+
+	code := subject + "-code"
+	p.mu.Lock()
+	p.logins[code] = jwt.MapClaims{
+		"iss":            p.server.URL,
+		"aud":            fakeOIDCClientID,
+		"sub":            subject,
+		"email":          email,
+		"email_verified": true,
+		"nonce":          query.Get("nonce"),
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Minute).Unix(),
+	}
+	p.mu.Unlock()
+
+	return url.Values{"state": {query.Get("state")}, "code": {code}}
+}
+
+var testOIDC *fakeOIDC
+
+// TestMain configures Google and the fake provider before the providers are
+// loaded, which only happens once per process.
+func TestMain(m *testing.M) {
+	testOIDC = newFakeOIDC()
+	providers, _ := json.Marshal([]utils.ProviderConfig{{
+		Name:         "fake",
+		Issuer:       testOIDC.server.URL,
+		ClientID:     fakeOIDCClientID,
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:8080/auth/fake/callback",
+	}})
+	os.Setenv("OIDC_PROVIDERS", string(providers))
+	os.Setenv("GOOGLE_CLIENT_ID", "client-id")
+	os.Setenv("GOOGLE_OAUTH_REDIRECT_URL", "http://localhost:8080/auth/google/callback")
+
+	code := m.Run()
+	testOIDC.server.Close()
+	os.Exit(code)
+}
+
+// get sends a GET with the given cookies and returns the recorded response
+func get(r *gin.Engine, target string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func responseCookie(w *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func TestIdentityLinkThroughProviderCallback(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "linker@example.com", models.RoleUser)
+	other := createTestUser(t, "other@example.com", models.RoleUser)
+
+	r := gin.New()
+	r.POST("/identities/:provider/link", signedInAs(user), StartIdentityLink)
+	r.GET("/auth/:provider", OAuthLogin)
+	r.GET("/auth/:provider/callback", OAuthCallback)
+	r.POST("/identities/link/complete", signedInAs(user), CompleteIdentityLink)
+	r.POST("/other/identities/link/complete", signedInAs(other), CompleteIdentityLink)
+
+	status, start := postJSON(t, r, "/identities/fake/link", gin.H{"redirect_to": "/settings"})
+	if status != 200 {
+		t.Fatalf("start link: %d %v", status, start)
+	}
+
+	// The browser opens the URL as a top-level navigation and only carries
+	// the state cookie set there back to the callback
+	w := get(r, start["url"].(string))
+	stateCookie := responseCookie(w, oauthStateCookie)
+	if w.Code != 302 || stateCookie == nil {
+		t.Fatalf("open link URL: %d %s", w.Code, w.Body.String())
+	}
+	callback := testOIDC.login(t, w.Header().Get("Location"), "fake-subject", "linker@provider.example")
+
+	w = get(r, "/auth/fake/callback?"+callback.Encode(), stateCookie)
+	if w.Code != 302 {
+		t.Fatalf("callback: %d %s", w.Code, w.Body.String())
+	}
+	redirect, _ := url.Parse(w.Header().Get("Location"))
+	linkToken := redirect.Query().Get("link_token")
+	if redirect.Path != "/auth/link/complete" || linkToken == "" || redirect.Query().Get("redirect_to") != "/settings" {
+		t.Fatalf("callback redirected to %s", redirect)
+	}
+
+	var count int64
+	models.DB.Model(&models.Identity{}).Count(&count)
+	if count != 0 {
+		t.Fatal("identity was linked before the signed-in user completed it")
+	}
+
+	// Someone else's session cannot claim the login
+	status, response := postJSON(t, r, "/other/identities/link/complete", gin.H{"link_token": linkToken})
+	if status != 400 {
+		t.Fatalf("complete as another user: %d %v, want 400", status, response)
+	}
+
+	status, response = postJSON(t, r, "/identities/link/complete", gin.H{"link_token": linkToken})
+	if status != 200 {
+		t.Fatalf("complete link: %d %v", status, response)
+	}
+	var identity models.Identity
+	if err := models.DB.Where("provider = ? AND subject = ?", "fake", "fake-subject").First(&identity).Error; err != nil || identity.UserID != user.ID {
+		t.Fatalf("identity = %+v, %v; want it linked to user %d", identity, err, user.ID)
+	}
+
+	status, response = postJSON(t, r, "/identities/link/complete", gin.H{"link_token": linkToken})
+	if status != 400 {
+		t.Fatalf("reused link token: %d %v, want 400", status, response)
+	}
+
+	// The password confirmation meant for provider sign-ups does not accept it
+	r.POST("/identities/link/password", ConfirmLinkWithPassword)
+	status, response = postJSON(t, r, "/identities/link/password", gin.H{"link_token": linkToken, "password": "anything"})
+	if status != 400 {
+		t.Fatalf("signed-in link confirmed by password: %d %v, want 400", status, response)
+	}
+}
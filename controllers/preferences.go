@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"go-auth-app/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetPreferences Function to return the current user's notification preferences
+func GetPreferences(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(200, gin.H{"notify_new_device": user.NotifyNewDevice})
+}
+
+// UpdatePreferences Function to change the current user's notification preferences
+func UpdatePreferences(c *gin.Context) {
+	var request struct {
+		NotifyNewDevice *bool `json:"notify_new_device"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	if request.NotifyNewDevice != nil {
+		if err := models.DB.Model(&user).Update("notify_new_device", *request.NotifyNewDevice).Error; err != nil {
+			c.JSON(500, gin.H{"error": "Failed to update preferences"})
+			return
+		}
+		user.NotifyNewDevice = *request.NotifyNewDevice
+	}
+
+	c.JSON(200, gin.H{"success": "Preferences updated", "notify_new_device": user.NotifyNewDevice})
+}
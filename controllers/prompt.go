@@ -0,0 +1,34 @@
+package controllers
+
+import (
+	"go-auth-app/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetPrompt Function to return one of the current user's prompts with the
+// jokes generated for it
+func GetPrompt(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var prompt models.Prompt
+	if err := models.DB.Preload("Jokes", orderJokes).
+		Where("id = ? AND user_id = ?", c.Param("id"), userID).
+		First(&prompt).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Prompt not found"})
+		return
+	}
+
+	c.JSON(200, prompt)
+}
+
+// orderJokes returns a prompt's jokes grouped by language in the order the
+// model wrote them
+func orderJokes(db *gorm.DB) *gorm.DB {
+	return db.Order("language, position")
+}
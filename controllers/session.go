@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"go-auth-app/models"
+	"go-auth-app/utils"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loginReportTTL is how long the "this wasn't me" link in a new-device email
+// stays valid
+const loginReportTTL = 7 * 24 * time.Hour
+
+// ListSessions Function to list the devices the current user is signed in on
+func ListSessions(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	sessions, err := utils.ListSessions(userID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to retrieve sessions"})
+		return
+	}
+
+	currentID := currentSessionID(c)
+	response := []gin.H{}
+	for _, session := range sessions {
+		response = append(response, gin.H{
+			"id":           session.ID,
+			"device":       session.Device,
+			"user_agent":   session.UserAgent,
+			"ip_address":   session.IPAddress,
+			"auth_method":  session.AuthMethod,
+			"created_at":   session.CreatedAt,
+			"last_seen_at": session.LastSeenAt,
+			"expires_at":   session.ExpiresAt,
+			"current":      session.ID == currentID,
+		})
+	}
+
+	c.JSON(200, gin.H{"sessions": response})
+}
+
+// RevokeSession Function to sign the current user out of one device
+func RevokeSession(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	sessionID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(404, gin.H{"error": "Session not found"})
+		return
+	}
+
+	if err := utils.RevokeSession(userID, uint(sessionID)); err != nil {
+		if errors.Is(err, utils.ErrSessionNotFound) {
+			c.JSON(404, gin.H{"error": "Session not found"})
+			return
+		}
+		c.JSON(500, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	if uint(sessionID) == currentSessionID(c) {
+		clearSessionCookies(c)
+	}
+	c.JSON(200, gin.H{"success": "Session revoked"})
+}
+
+// currentSessionID returns the session of the access token used for the
+// request, or 0 for API keys and tokens issued before sessions existed
+func currentSessionID(c *gin.Context) uint {
+	if value, exists := c.Get("claims"); exists {
+		return value.(*models.Claims).SessionID
+	}
+	return 0
+}
+
+// ReportSession Function to handle the "this wasn't me" link of a new-device
+// email. The reported session is signed out and a password reset token is
+// returned so the frontend can take the user straight to the reset form.
+func ReportSession(c *gin.Context) {
+	var request struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	emailToken, err := utils.ConsumeEmailToken(request.Token, models.EmailTokenLoginReport)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid or expired link"})
+		return
+	}
+
+	if emailToken.SessionID != nil {
+		if err := utils.RevokeSession(emailToken.UserID, *emailToken.SessionID); err != nil && !errors.Is(err, utils.ErrSessionNotFound) {
+			c.JSON(500, gin.H{"error": "Failed to revoke session"})
+			return
+		}
+	}
+
+	resetToken, err := utils.CreateEmailToken(emailToken.UserID, models.EmailTokenPasswordReset, passwordResetTTL)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to create reset token"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"success":     "The session has been signed out. Please choose a new password.",
+		"reset_token": resetToken,
+		"expires_in":  int(passwordResetTTL.Seconds()),
+	})
+}
+
+// notifyNewDevice emails the user when they log in from a user-agent and IP
+// address we have not seen for them. Failures are logged rather than failing
+// the login.
+func notifyNewDevice(user models.User, session *models.Session) {
+	isNew, err := utils.RememberDevice(user.ID, session.UserAgent, session.IPAddress)
+	if err != nil {
+		log.Printf("Failed to record device for user %d: %v", user.ID, err)
+		return
+	}
+	if !isNew || !user.NotifyNewDevice {
+		return
+	}
+
+	token, err := utils.CreateLoginReportToken(user.ID, session.ID, loginReportTTL)
+	if err != nil {
+		log.Printf("Failed to create login report token for user %d: %v", user.ID, err)
+		return
+	}
+
+	data := map[string]string{
+		"Time":       session.CreatedAt.UTC().Format("January 2, 2006 at 15:04 UTC"),
+		"Device":     session.Device,
+		"IPAddress":  session.IPAddress,
+		"ReportLink": fmt.Sprintf("%s/sessions/report?token=%s", utils.FrontendURL(), token),
+		"ExpiresIn":  "7 days",
+	}
+	templatePath := "templates/new_device_template.html"
+	sendEmail(user.Email, "New Sign-In to Your JokeMaster Account", templatePath, data)
+}
@@ -0,0 +1,251 @@
+package controllers
+
+import (
+	"errors"
+	"go-auth-app/models"
+	"go-auth-app/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type tokenPair struct {
+	AccessToken  string
+	RefreshToken string
+}
+
+// issueTokens starts a session for the device making the request and issues
+// its first access and refresh tokens
+func issueTokens(c *gin.Context, user models.User, authMethod string) (tokenPair, error) {
+	if user.SuspendedAt != nil {
+		return tokenPair{}, utils.ErrAccountSuspended
+	}
+
+	session, err := utils.StartSession(user.ID, authMethod, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		return tokenPair{}, err
+	}
+
+	accessToken, err := utils.GenerateJWT(user, session.ID)
+	if err != nil {
+		return tokenPair{}, err
+	}
+
+	refreshToken, err := utils.IssueRefreshToken(user.ID, session.FamilyID)
+	if err != nil {
+		return tokenPair{}, err
+	}
+
+	notifyNewDevice(user, session)
+
+	return tokenPair{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+// completeLogin responds to a successful first-factor login. Users with 2FA
+// enabled receive an mfa_pending token instead of access tokens.
+func completeLogin(c *gin.Context, user models.User, authMethod string) {
+	if user.SuspendedAt != nil {
+		writeTokenError(c, utils.ErrAccountSuspended)
+		return
+	}
+
+	if user.TOTPEnabled {
+		mfaToken, err := utils.GenerateMFAPendingJWT(user.ID, user.Email, authMethod)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Error generating token"})
+			return
+		}
+		c.JSON(200, gin.H{
+			"success":      "Two-factor authentication required",
+			"mfa_required": true,
+			"mfa_token":    mfaToken,
+			"expires_in":   int(utils.MFAPendingTTL.Seconds()),
+		})
+		return
+	}
+
+	tokens, err := issueTokens(c, user, authMethod)
+	if err != nil {
+		writeTokenError(c, err)
+		return
+	}
+
+	writeTokens(c, "Successfully logged in", tokens)
+}
+
+// writeTokenError responds to a failure to issue tokens
+func writeTokenError(c *gin.Context, err error) {
+	if errors.Is(err, utils.ErrAccountSuspended) {
+		c.JSON(403, gin.H{"error": "Your account has been suspended"})
+		return
+	}
+	c.JSON(500, gin.H{"error": "Error generating token"})
+}
+
+// revokeAllSessions signs the user out everywhere by invalidating every
+// session, access token and refresh token
+func revokeAllSessions(userID uint) error {
+	return utils.RevokeUserAccess(models.DB, userID)
+}
+
+// writeTokens sends a freshly issued token pair to the client, in the
+// response body in bearer mode or in HttpOnly cookies in cookie mode.
+func writeTokens(c *gin.Context, message string, tokens tokenPair) {
+	if !utils.CookieSessions() {
+		c.JSON(200, tokenResponse(message, tokens))
+		return
+	}
+
+	csrfToken, err := utils.GenerateCSRFToken()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error generating token"})
+		return
+	}
+
+	setSessionCookie(c, utils.AccessTokenCookie, tokens.AccessToken, int(utils.AccessTokenTTL.Seconds()), true)
+	setSessionCookie(c, utils.RefreshTokenCookie, tokens.RefreshToken, int(utils.RefreshTokenTTL.Seconds()), true)
+	// Readable by the frontend so it can echo it in the CSRF header. It is
+	// also returned in the body for frontends on another site, which cannot
+	// read the API's cookies.
+	setSessionCookie(c, utils.CSRFCookie, csrfToken, int(utils.RefreshTokenTTL.Seconds()), false)
+
+	c.JSON(200, gin.H{
+		"success":    message,
+		"csrf_token": csrfToken,
+		"expires_in": int(utils.AccessTokenTTL.Seconds()),
+	})
+}
+
+// CSRFToken Function to issue a new CSRF token for the current cookie
+// session. Frontends that lost the token returned at login, e.g. after a
+// reload on a site that cannot read the API's cookies, fetch a fresh one
+// here instead of signing in again.
+func CSRFToken(c *gin.Context) {
+	if !utils.CookieSessions() {
+		c.JSON(404, gin.H{"error": "CSRF tokens are only used with cookie sessions"})
+		return
+	}
+
+	csrfToken, err := utils.GenerateCSRFToken()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error generating token"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	setSessionCookie(c, utils.CSRFCookie, csrfToken, int(utils.RefreshTokenTTL.Seconds()), false)
+	c.JSON(200, gin.H{"csrf_token": csrfToken})
+}
+
+// clearSessionCookies removes the session cookies set by writeTokens
+func clearSessionCookies(c *gin.Context) {
+	if !utils.CookieSessions() {
+		return
+	}
+	setSessionCookie(c, utils.AccessTokenCookie, "", -1, true)
+	setSessionCookie(c, utils.RefreshTokenCookie, "", -1, true)
+	setSessionCookie(c, utils.CSRFCookie, "", -1, false)
+}
+
+func setSessionCookie(c *gin.Context, name, value string, maxAge int, httpOnly bool) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Domain:   utils.SessionCookieDomain(),
+		MaxAge:   maxAge,
+		Secure:   true,
+		HttpOnly: httpOnly,
+		SameSite: utils.SessionCookieSameSite(),
+	})
+}
+
+// refreshTokenFromRequest returns the refresh token from the request body or,
+// in cookie mode, from the refresh token cookie. A cookie is sent by the
+// browser automatically, so using it requires a valid CSRF token.
+func refreshTokenFromRequest(c *gin.Context) (string, bool) {
+	var request struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := c.ShouldBindJSON(&request); err == nil && request.RefreshToken != "" {
+		return request.RefreshToken, true
+	}
+
+	if !utils.CookieSessions() {
+		return "", false
+	}
+	token, err := c.Cookie(utils.RefreshTokenCookie)
+	if err != nil || token == "" {
+		return "", false
+	}
+	csrfCookie, _ := c.Cookie(utils.CSRFCookie)
+	if !utils.ValidCSRFToken(csrfCookie, c.GetHeader(utils.CSRFHeader)) {
+		return "", false
+	}
+	return token, true
+}
+
+func tokenResponse(message string, tokens tokenPair) gin.H {
+	return gin.H{
+		"success":       message,
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"token_type":    "Bearer",
+		"expires_in":    int(utils.AccessTokenTTL.Seconds()),
+	}
+}
+
+// RefreshToken Function to exchange a refresh token for a new token pair
+func RefreshToken(c *gin.Context) {
+	presented, ok := refreshTokenFromRequest(c)
+	if !ok {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	refreshToken, record, err := utils.RotateRefreshToken(presented)
+	if err != nil {
+		if errors.Is(err, utils.ErrInvalidRefreshToken) || errors.Is(err, utils.ErrRefreshTokenReused) {
+			c.JSON(401, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+		c.JSON(500, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+
+	var user models.User
+	if err := models.DB.First(&user, record.UserID).Error; err != nil {
+		c.JSON(401, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	session, err := utils.SessionForFamily(user.ID, record.FamilyID, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+	if session.RevokedAt != nil {
+		c.JSON(401, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	accessToken, err := utils.GenerateJWT(user, session.ID)
+	if err != nil {
+		writeTokenError(c, err)
+		return
+	}
+
+	writeTokens(c, "Token refreshed", tokenPair{AccessToken: accessToken, RefreshToken: refreshToken})
+}
+
+// JWKS Function to publish the public keys that access tokens are signed with
+func JWKS(c *gin.Context) {
+	keys, err := utils.Keys()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Signing keys are not configured"})
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(200, gin.H{"keys": keys.JWKS()})
+}
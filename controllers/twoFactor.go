@@ -0,0 +1,285 @@
+package controllers
+
+import (
+	"go-auth-app/models"
+	"go-auth-app/utils"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const recoveryCodeCount = 10
+
+type twoFactorRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// EnrollTOTP Function to start 2FA enrollment for the current user
+func EnrollTOTP(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.TOTPEnabled {
+		c.JSON(409, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+
+	recoveryCodes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{"totp_secret": secret, "totp_last_step": 0}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		for _, code := range recoveryCodes {
+			recoveryCode := models.RecoveryCode{UserID: user.ID, CodeHash: utils.HashToken(utils.NormalizeRecoveryCode(code))}
+			if err := tx.Create(&recoveryCode).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to start two-factor enrollment"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"success":        "Scan the QR code with your authenticator app, then confirm with a code",
+		"secret":         secret,
+		"otpauth_uri":    utils.TOTPURI(secret, user.Email),
+		"recovery_codes": recoveryCodes,
+	})
+}
+
+// ConfirmTOTP Function to verify the first code and enable 2FA
+func ConfirmTOTP(c *gin.Context) {
+	var request struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.TOTPEnabled {
+		c.JSON(409, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if user.TOTPSecret == "" {
+		c.JSON(400, gin.H{"error": "Two-factor enrollment has not been started"})
+		return
+	}
+
+	step, valid := utils.ValidateTOTP(user.TOTPSecret, request.Code, time.Now())
+	if !valid {
+		c.JSON(400, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	if err := models.DB.Model(&user).Updates(map[string]interface{}{"totp_enabled": true, "totp_last_step": step}).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	c.JSON(200, gin.H{"success": "Two-factor authentication enabled"})
+}
+
+// DisableTOTP Function to turn off 2FA after checking a code or recovery code
+func DisableTOTP(c *gin.Context) {
+	var request twoFactorRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	if !user.TOTPEnabled {
+		c.JSON(400, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	valid, err := verifySecondFactor(user, request)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	if !valid {
+		c.JSON(401, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{"totp_enabled": false, "totp_secret": "", "totp_last_step": 0}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	c.JSON(200, gin.H{"success": "Two-factor authentication disabled"})
+}
+
+// LoginTwoFactor Function to exchange an mfa_pending token and a second factor for real tokens
+func LoginTwoFactor(c *gin.Context) {
+	var request struct {
+		MFAToken string `json:"mfa_token" binding:"required"`
+		twoFactorRequest
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	claims, err := utils.ParseJWTWithPurpose(request.MFAToken, models.PurposeMFAPending)
+	if err != nil {
+		c.JSON(401, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	var user models.User
+	if err := models.DB.First(&user, claims.UserID).Error; err != nil || !user.TOTPEnabled {
+		c.JSON(401, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	// Second factor guesses count against the account and IP like password
+	// guesses, so spreading them over many IPs does not help
+	accountKey := utils.AccountThrottleKey(user.Email)
+	ipKey := utils.IPThrottleKey(c.ClientIP())
+
+	lockedFor, err := utils.LoginLockedFor(accountKey, ipKey)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to check login attempts"})
+		return
+	}
+	if lockedFor > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(lockedFor.Seconds()))))
+		c.JSON(429, gin.H{"error": "Too many failed login attempts. Please try again later."})
+		return
+	}
+
+	valid, err := verifySecondFactor(user, request.twoFactorRequest)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	if !valid {
+		recordLoginFailure(user, accountKey, ipKey)
+
+		// Each pending token only gets a few guesses
+		locked, _, err := utils.RecordLoginFailure(utils.MFATokenThrottleKey(claims.ID), utils.MFATokenThrottlePolicy)
+		if err != nil {
+			log.Printf("Failed to record second factor failure: %v", err)
+		}
+		if locked {
+			if err := utils.RevokeToken(claims.ID, claims.UserID, claims.ExpiresAt.Time); err != nil {
+				log.Printf("Failed to revoke mfa token: %v", err)
+			}
+		}
+
+		c.JSON(401, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	// The pending token has served its purpose
+	if err := utils.RevokeToken(claims.ID, claims.UserID, claims.ExpiresAt.Time); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to complete login"})
+		return
+	}
+
+	if err := utils.ResetLoginThrottle(accountKey, utils.MFATokenThrottleKey(claims.ID)); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to record login attempt"})
+		return
+	}
+
+	tokens, err := issueTokens(c, user, claims.AuthMethod)
+	if err != nil {
+		writeTokenError(c, err)
+		return
+	}
+
+	writeTokens(c, "Successfully logged in", tokens)
+}
+
+// verifySecondFactor checks a TOTP code or consumes a recovery code. A TOTP
+// code is accepted at most once.
+func verifySecondFactor(user models.User, request twoFactorRequest) (bool, error) {
+	if request.Code != "" {
+		step, valid := utils.ValidateTOTP(user.TOTPSecret, request.Code, time.Now())
+		if !valid {
+			return false, nil
+		}
+
+		result := models.DB.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		if result.Error != nil {
+			return false, result.Error
+		}
+		return result.RowsAffected == 1, nil
+	}
+
+	if request.RecoveryCode != "" {
+		hash := utils.HashToken(utils.NormalizeRecoveryCode(request.RecoveryCode))
+		result := models.DB.Model(&models.RecoveryCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hash).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return false, result.Error
+		}
+		return result.RowsAffected == 1, nil
+	}
+
+	return false, nil
+}
+
+// currentUser loads the authenticated user, writing an error response if
+// that is not possible.
+func currentUser(c *gin.Context) (models.User, bool) {
+	var user models.User
+
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return user, false
+	}
+
+	if err := models.DB.First(&user, userID.(uint)).Error; err != nil {
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return user, false
+	}
+
+	return user, true
+}
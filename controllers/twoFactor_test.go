@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+
+	"go-auth-app/models"
+	"go-auth-app/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// currentTOTP computes the code an authenticator app would show now
+func currentTOTP(t *testing.T, secret string) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatalf("decode secret: %v", err)
+	}
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(time.Now().Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:offset+4])&0x7fffffff)%1000000)
+}
+
+func createTOTPUser(t *testing.T, email string) (models.User, string) {
+	t.Helper()
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("generate secret: %v", err)
+	}
+	user := createTestUser(t, email, models.RoleUser)
+	if err := models.DB.Model(&user).Updates(map[string]interface{}{"totp_secret": secret, "totp_enabled": true}).Error; err != nil {
+		t.Fatalf("enable totp: %v", err)
+	}
+	return user, secret
+}
+
+func TestLoginTwoFactor(t *testing.T) {
+	setupTestDB(t)
+	user, secret := createTOTPUser(t, "totp@example.com")
+	mfaToken, err := utils.GenerateMFAPendingJWT(user.ID, user.Email, models.AuthMethodPassword)
+	if err != nil {
+		t.Fatalf("generate mfa token: %v", err)
+	}
+
+	r := gin.New()
+	r.POST("/login/2fa", LoginTwoFactor)
+
+	status, response := postJSON(t, r, "/login/2fa", gin.H{"mfa_token": mfaToken, "code": currentTOTP(t, secret)})
+	if status != 200 || response["access_token"] == nil {
+		t.Fatalf("login with a valid code: %d %v", status, response)
+	}
+
+	// The pending token is single use
+	status, response = postJSON(t, r, "/login/2fa", gin.H{"mfa_token": mfaToken, "code": currentTOTP(t, secret)})
+	if status != 401 {
+		t.Fatalf("reused mfa token: %d %v, want 401", status, response)
+	}
+}
+
+func TestLoginTwoFactorLimitsGuesses(t *testing.T) {
+	setupTestDB(t)
+	user, secret := createTOTPUser(t, "guess@example.com")
+	mfaToken, err := utils.GenerateMFAPendingJWT(user.ID, user.Email, models.AuthMethodPassword)
+	if err != nil {
+		t.Fatalf("generate mfa token: %v", err)
+	}
+
+	r := gin.New()
+	r.POST("/login/2fa", LoginTwoFactor)
+
+	wrong := "000000"
+	if wrong == currentTOTP(t, secret) {
+		wrong = "111111"
+	}
+	for i := 0; i < utils.MFATokenThrottlePolicy.Threshold; i++ {
+		status, response := postJSON(t, r, "/login/2fa", gin.H{"mfa_token": mfaToken, "code": wrong})
+		if status != 401 {
+			t.Fatalf("guess %d: %d %v, want 401", i+1, status, response)
+		}
+	}
+
+	if _, err := utils.ParseJWTWithPurpose(mfaToken, models.PurposeMFAPending); err == nil {
+		t.Fatal("mfa token still valid after too many wrong codes")
+	}
+
+	// The account stays locked for new pending tokens as well
+	fresh, err := utils.GenerateMFAPendingJWT(user.ID, user.Email, models.AuthMethodPassword)
+	if err != nil {
+		t.Fatalf("generate mfa token: %v", err)
+	}
+	status, response := postJSON(t, r, "/login/2fa", gin.H{"mfa_token": fresh, "code": currentTOTP(t, secret)})
+	if status != 429 {
+		t.Fatalf("valid code while locked: %d %v, want 429", status, response)
+	}
+}
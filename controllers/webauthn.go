@@ -0,0 +1,325 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"go-auth-app/models"
+	"go-auth-app/utils"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+type webAuthnFinishRequest struct {
+	SessionID  string          `json:"session_id" binding:"required"`
+	Name       string          `json:"name"`
+	Credential json.RawMessage `json:"credential" binding:"required"`
+}
+
+// BeginPasskeyRegistration Function to start registering a passkey for the current user
+func BeginPasskeyRegistration(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	relyingParty, err := utils.WebAuthn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Passkeys are not configured"})
+		return
+	}
+
+	user, err := utils.LoadWebAuthnUser(userID.(uint))
+	if err != nil {
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	excluded := webauthn.Credentials(user.WebAuthnCredentials()).CredentialDescriptors()
+	options, session, err := relyingParty.BeginRegistration(user,
+		webauthn.WithExclusions(excluded),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+	)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to start passkey registration"})
+		return
+	}
+
+	sessionID, err := utils.SaveWebAuthnSession(user.User.ID, utils.WebAuthnCeremonyRegistration, session)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to start passkey registration"})
+		return
+	}
+
+	c.JSON(200, gin.H{"session_id": sessionID, "options": options})
+}
+
+// FinishPasskeyRegistration Function to verify the attestation and store the new passkey
+func FinishPasskeyRegistration(c *gin.Context) {
+	var request webAuthnFinishRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	relyingParty, err := utils.WebAuthn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Passkeys are not configured"})
+		return
+	}
+
+	session, sessionUserID, err := utils.ConsumeWebAuthnSession(request.SessionID, utils.WebAuthnCeremonyRegistration)
+	if err != nil || sessionUserID != userID.(uint) {
+		c.JSON(400, gin.H{"error": "Invalid or expired registration session"})
+		return
+	}
+
+	user, err := utils.LoadWebAuthnUser(userID.(uint))
+	if err != nil {
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(request.Credential))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid credential"})
+		return
+	}
+
+	credential, err := relyingParty.CreateCredential(user, session, parsed)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Passkey registration failed"})
+		return
+	}
+
+	transports := make([]string, 0, len(credential.Transport))
+	for _, transport := range credential.Transport {
+		transports = append(transports, string(transport))
+	}
+
+	name := strings.TrimSpace(request.Name)
+	if name == "" {
+		name = "Passkey"
+	}
+
+	stored := models.WebAuthnCredential{
+		UserID:          user.User.ID,
+		Name:            name,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		Transports:      strings.Join(transports, ","),
+		UserVerified:    credential.Flags.UserVerified,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+	}
+	if err := models.DB.Create(&stored).Error; err != nil {
+		c.JSON(409, gin.H{"error": "Passkey is already registered"})
+		return
+	}
+
+	c.JSON(200, gin.H{"success": "Passkey registered", "credential": stored})
+}
+
+// BeginPasskeyLogin Function to start a passkey assertion. Without an email
+// the browser offers any discoverable passkey for this site.
+func BeginPasskeyLogin(c *gin.Context) {
+	var request struct {
+		Email string `json:"email"`
+	}
+	// The body is optional
+	_ = c.ShouldBindJSON(&request)
+
+	relyingParty, err := utils.WebAuthn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Passkeys are not configured"})
+		return
+	}
+
+	var options *protocol.CredentialAssertion
+	var session *webauthn.SessionData
+	var sessionUserID uint
+
+	var user models.User
+	if request.Email != "" {
+		models.DB.Where("email = ?", request.Email).First(&user)
+	}
+
+	var webAuthnUser utils.WebAuthnUser
+	if user.ID != 0 {
+		webAuthnUser, err = utils.LoadWebAuthnUser(user.ID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to start passkey login"})
+			return
+		}
+	}
+
+	// A passkey login skips the second factor, so the authenticator must
+	// verify the user with a PIN or biometric and not just their presence
+	requireUV := webauthn.WithUserVerification(protocol.VerificationRequired)
+
+	// Unknown emails fall back to a discoverable login so the response does
+	// not reveal whether an account exists.
+	if len(webAuthnUser.Credentials) > 0 {
+		options, session, err = relyingParty.BeginLogin(webAuthnUser, requireUV)
+		sessionUserID = webAuthnUser.User.ID
+	} else {
+		options, session, err = relyingParty.BeginDiscoverableLogin(requireUV)
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to start passkey login"})
+		return
+	}
+
+	sessionID, err := utils.SaveWebAuthnSession(sessionUserID, utils.WebAuthnCeremonyLogin, session)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to start passkey login"})
+		return
+	}
+
+	c.JSON(200, gin.H{"session_id": sessionID, "options": options})
+}
+
+// FinishPasskeyLogin Function to verify a passkey assertion and log the user in
+func FinishPasskeyLogin(c *gin.Context) {
+	var request webAuthnFinishRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	relyingParty, err := utils.WebAuthn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Passkeys are not configured"})
+		return
+	}
+
+	session, sessionUserID, err := utils.ConsumeWebAuthnSession(request.SessionID, utils.WebAuthnCeremonyLogin)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid or expired login session"})
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(request.Credential))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid credential"})
+		return
+	}
+
+	var user utils.WebAuthnUser
+	var credential *webauthn.Credential
+	if sessionUserID != 0 {
+		user, err = utils.LoadWebAuthnUser(sessionUserID)
+		if err == nil {
+			credential, err = relyingParty.ValidateLogin(user, session, parsed)
+		}
+	} else {
+		credential, err = relyingParty.ValidateDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+			var stored models.WebAuthnCredential
+			if err := models.DB.Where("credential_id = ?", rawID).First(&stored).Error; err != nil {
+				return nil, err
+			}
+			loaded, err := utils.LoadWebAuthnUser(stored.UserID)
+			if err != nil {
+				return nil, err
+			}
+			if !bytes.Equal(loaded.User.WebAuthnHandle, userHandle) {
+				return nil, errors.New("user handle does not match credential")
+			}
+			user = loaded
+			return loaded, nil
+		}, session, parsed)
+	}
+	if err != nil {
+		c.JSON(401, gin.H{"error": "Passkey login failed"})
+		return
+	}
+
+	// A signature counter that went backwards suggests a cloned authenticator
+	if credential.Authenticator.CloneWarning {
+		models.DB.Model(&models.WebAuthnCredential{}).Where("credential_id = ?", credential.ID).Update("clone_warning", true)
+		c.JSON(401, gin.H{"error": "Passkey login failed"})
+		return
+	}
+
+	now := time.Now()
+	if err := models.DB.Model(&models.WebAuthnCredential{}).
+		Where("credential_id = ? AND user_id = ?", credential.ID, user.User.ID).
+		Updates(map[string]interface{}{
+			"sign_count":   credential.Authenticator.SignCount,
+			"backup_state": credential.Flags.BackupState,
+			"last_used_at": now,
+		}).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to update passkey"})
+		return
+	}
+
+	tokens, err := issueTokens(c, user.User, models.AuthMethodPasskey)
+	if err != nil {
+		writeTokenError(c, err)
+		return
+	}
+
+	writeTokens(c, "Successfully logged in", tokens)
+}
+
+// ListPasskeys Function to list the current user's passkeys
+func ListPasskeys(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var credentials []models.WebAuthnCredential
+	if err := models.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&credentials).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to retrieve passkeys"})
+		return
+	}
+
+	c.JSON(200, credentials)
+}
+
+// DeletePasskey Function to remove one of the current user's passkeys
+func DeletePasskey(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var credential models.WebAuthnCredential
+	if err := models.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&credential).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Passkey not found"})
+		return
+	}
+
+	if !ensureAnotherLoginMethod(c, userID.(uint)) {
+		return
+	}
+
+	result := models.DB.Unscoped().Delete(&credential)
+	if result.Error != nil {
+		c.JSON(500, gin.H{"error": "Failed to delete passkey"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(404, gin.H{"error": "Passkey not found"})
+		return
+	}
+
+	c.JSON(200, gin.H{"success": "Passkey deleted"})
+}
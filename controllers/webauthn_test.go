@@ -0,0 +1,305 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-auth-app/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+)
+
+const (
+	testRPID   = "localhost"
+	testOrigin = "http://localhost:3000"
+
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+)
+
+var b64 = base64.RawURLEncoding
+
+// softAuthenticator is a passkey held in memory. It answers ceremonies the
+// way a browser and platform authenticator would.
+type softAuthenticator struct {
+	t            *testing.T
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+	// presenceOnly answers assertions without verifying the user, like a
+	// security key without a PIN
+	presenceOnly bool
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	credentialID := make([]byte, 16)
+	rand.Read(credentialID)
+	return &softAuthenticator{t: t, key: key, credentialID: credentialID}
+}
+
+func (a *softAuthenticator) clientData(ceremony, challenge string) []byte {
+	data, _ := json.Marshal(map[string]string{"type": ceremony, "challenge": challenge, "origin": testOrigin})
+	return data
+}
+
+func (a *softAuthenticator) authenticatorData(flags byte, extra []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	return append(data, extra...)
+}
+
+// register answers the options from BeginPasskeyRegistration with a "none"
+// attestation.
+func (a *softAuthenticator) register(options gin.H) json.RawMessage {
+	publicKey := options["publicKey"].(map[string]interface{})
+	user := publicKey["user"].(map[string]interface{})
+	handle, err := b64.DecodeString(user["id"].(string))
+	if err != nil {
+		a.t.Fatalf("decode user handle: %v", err)
+	}
+	a.userHandle = handle
+
+	coseKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: a.key.X.FillBytes(make([]byte, 32)),
+		YCoord: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		a.t.Fatalf("encode public key: %v", err)
+	}
+
+	attested := make([]byte, 16) // AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialID)))
+	attested = append(attested, a.credentialID...)
+	attested = append(attested, coseKey...)
+
+	attestation, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authenticatorData(flagUserPresent|flagUserVerified|flagAttestedData, attested),
+	})
+	if err != nil {
+		a.t.Fatalf("encode attestation: %v", err)
+	}
+
+	return a.credential(gin.H{
+		"clientDataJSON":    b64.EncodeToString(a.clientData("webauthn.create", publicKey["challenge"].(string))),
+		"attestationObject": b64.EncodeToString(attestation),
+	})
+}
+
+// assert signs the challenge from BeginPasskeyLogin with the current
+// signature counter.
+func (a *softAuthenticator) assert(options gin.H) json.RawMessage {
+	publicKey := options["publicKey"].(map[string]interface{})
+	clientData := a.clientData("webauthn.get", publicKey["challenge"].(string))
+	flags := byte(flagUserPresent | flagUserVerified)
+	if a.presenceOnly {
+		flags = flagUserPresent
+	}
+	authData := a.authenticatorData(flags, nil)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatalf("sign assertion: %v", err)
+	}
+
+	return a.credential(gin.H{
+		"clientDataJSON":    b64.EncodeToString(clientData),
+		"authenticatorData": b64.EncodeToString(authData),
+		"signature":         b64.EncodeToString(signature),
+		"userHandle":        b64.EncodeToString(a.userHandle),
+	})
+}
+
+func (a *softAuthenticator) credential(response gin.H) json.RawMessage {
+	data, _ := json.Marshal(gin.H{
+		"id":       b64.EncodeToString(a.credentialID),
+		"rawId":    b64.EncodeToString(a.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+	return data
+}
+
+func passkeyRouter(user models.User) *gin.Engine {
+	r := gin.New()
+	r.POST("/webauthn/register/begin", signedInAs(user), BeginPasskeyRegistration)
+	r.POST("/webauthn/register/finish", signedInAs(user), FinishPasskeyRegistration)
+	r.POST("/webauthn/login/begin", BeginPasskeyLogin)
+	r.POST("/webauthn/login/finish", FinishPasskeyLogin)
+	return r
+}
+
+func postJSON(t *testing.T, r *gin.Engine, path string, body interface{}) (int, gin.H) {
+	t.Helper()
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var response gin.H
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("%s: decode response %q: %v", path, w.Body.String(), err)
+	}
+	return w.Code, response
+}
+
+func registerPasskey(t *testing.T, r *gin.Engine, authenticator *softAuthenticator) {
+	t.Helper()
+	status, begin := postJSON(t, r, "/webauthn/register/begin", gin.H{})
+	if status != 200 {
+		t.Fatalf("begin registration: %d %v", status, begin)
+	}
+
+	status, finish := postJSON(t, r, "/webauthn/register/finish", gin.H{
+		"session_id": begin["session_id"],
+		"name":       "Test key",
+		"credential": authenticator.register(begin["options"].(map[string]interface{})),
+	})
+	if status != 200 {
+		t.Fatalf("finish registration: %d %v", status, finish)
+	}
+}
+
+// loginWithPasskey runs a login ceremony and returns the finish request so
+// tests can replay it.
+func loginWithPasskey(t *testing.T, r *gin.Engine, email string, authenticator *softAuthenticator) (int, gin.H, gin.H) {
+	t.Helper()
+	status, begin := postJSON(t, r, "/webauthn/login/begin", gin.H{"email": email})
+	if status != 200 {
+		t.Fatalf("begin login: %d %v", status, begin)
+	}
+
+	request := gin.H{
+		"session_id": begin["session_id"],
+		"credential": authenticator.assert(begin["options"].(map[string]interface{})),
+	}
+	status, finish := postJSON(t, r, "/webauthn/login/finish", request)
+	return status, finish, request
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "passkey@example.com", models.RoleUser)
+	r := passkeyRouter(user)
+	authenticator := newSoftAuthenticator(t)
+
+	authenticator.signCount = 1
+	registerPasskey(t, r, authenticator)
+
+	var stored models.WebAuthnCredential
+	if err := models.DB.Where("user_id = ?", user.ID).First(&stored).Error; err != nil {
+		t.Fatalf("passkey was not stored: %v", err)
+	}
+	if !bytes.Equal(stored.CredentialID, authenticator.credentialID) || stored.Name != "Test key" {
+		t.Fatalf("stored passkey = %+v", stored)
+	}
+
+	authenticator.signCount = 2
+	status, response, request := loginWithPasskey(t, r, user.Email, authenticator)
+	if status != 200 || response["access_token"] == nil {
+		t.Fatalf("login: %d %v", status, response)
+	}
+
+	models.DB.First(&stored, stored.ID)
+	if stored.SignCount != 2 || stored.LastUsedAt == nil {
+		t.Fatalf("sign count = %d, last used = %v; want 2 and set", stored.SignCount, stored.LastUsedAt)
+	}
+
+	// Each challenge can only be answered once
+	status, response = postJSON(t, r, "/webauthn/login/finish", request)
+	if status != 400 {
+		t.Fatalf("replayed assertion: %d %v, want 400", status, response)
+	}
+}
+
+func TestPasskeyLoginRejectsReplayedSignCount(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "clone@example.com", models.RoleUser)
+	r := passkeyRouter(user)
+	authenticator := newSoftAuthenticator(t)
+
+	authenticator.signCount = 1
+	registerPasskey(t, r, authenticator)
+
+	// Without an email the passkey is found through its user handle
+	authenticator.signCount = 5
+	if status, response, _ := loginWithPasskey(t, r, "", authenticator); status != 200 {
+		t.Fatalf("login: %d %v", status, response)
+	}
+
+	// A cloned authenticator would answer a new challenge with a counter that
+	// did not move forward
+	status, response, _ := loginWithPasskey(t, r, "", authenticator)
+	if status != 401 {
+		t.Fatalf("login with reused sign count: %d %v, want 401", status, response)
+	}
+
+	var stored models.WebAuthnCredential
+	models.DB.Where("user_id = ?", user.ID).First(&stored)
+	if !stored.CloneWarning || stored.SignCount != 5 {
+		t.Fatalf("clone warning = %v, sign count = %d; want true and 5", stored.CloneWarning, stored.SignCount)
+	}
+}
+
+func TestPasskeyLoginRequiresUserVerification(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "presence@example.com", models.RoleUser)
+	r := passkeyRouter(user)
+	authenticator := newSoftAuthenticator(t)
+
+	authenticator.signCount = 1
+	registerPasskey(t, r, authenticator)
+
+	for _, email := range []string{user.Email, ""} {
+		status, begin := postJSON(t, r, "/webauthn/login/begin", gin.H{"email": email})
+		publicKey, _ := begin["options"].(map[string]interface{})["publicKey"].(map[string]interface{})
+		if status != 200 || publicKey["userVerification"] != "required" {
+			t.Fatalf("begin login for %q: %d %v; want user verification required", email, status, begin)
+		}
+	}
+
+	// A passkey login stands in for the password and second factor, so
+	// touching the key is not enough
+	authenticator.presenceOnly = true
+	authenticator.signCount = 2
+	if status, response, _ := loginWithPasskey(t, r, user.Email, authenticator); status != 401 {
+		t.Fatalf("login without user verification: %d %v, want 401", status, response)
+	}
+	authenticator.signCount = 3
+	if status, response, _ := loginWithPasskey(t, r, "", authenticator); status != 401 {
+		t.Fatalf("discoverable login without user verification: %d %v, want 401", status, response)
+	}
+
+	authenticator.presenceOnly = false
+	authenticator.signCount = 4
+	if status, response, _ := loginWithPasskey(t, r, user.Email, authenticator); status != 200 {
+		t.Fatalf("login with user verification: %d %v", status, response)
+	}
+}
@@ -0,0 +1,168 @@
+package jokegen
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const anthropicVersion = "2023-06-01"
+
+// anthropic talks to the Anthropic Messages API
+type anthropic struct {
+	config Config
+	client *http.Client
+}
+
+type anthropicRequest struct {
+	Model       string          `json:"model"`
+	MaxTokens   int             `json:"max_tokens"`
+	Temperature float64         `json:"temperature"`
+	Messages    []openAIMessage `json:"messages"`
+	Stream      bool            `json:"stream,omitempty"`
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type anthropicResponse struct {
+	Model   string `json:"model"`
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	Usage anthropicUsage `json:"usage"`
+}
+
+type anthropicStreamEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		Model string         `json:"model"`
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message"`
+	Delta struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"delta"`
+	Usage anthropicUsage `json:"usage"`
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func newAnthropic(config Config, client *http.Client) *anthropic {
+	if config.BaseURL == "" {
+		config.BaseURL = "https://api.anthropic.com/v1"
+	}
+	if config.Model == "" {
+		config.Model = "claude-3-5-haiku-latest"
+	}
+	// The Messages API accepts temperatures between 0 and 1
+	if config.Temperature > 1 {
+		config.Temperature = 1
+	}
+	return &anthropic{config: config, client: client}
+}
+
+func (g *anthropic) request(prompt string, stream bool) anthropicRequest {
+	return anthropicRequest{
+		Model:       g.config.Model,
+		MaxTokens:   g.config.MaxTokens,
+		Temperature: g.config.Temperature,
+		Messages:    []openAIMessage{{Role: "user", Content: prompt}},
+		Stream:      stream,
+	}
+}
+
+func (g *anthropic) headers() map[string]string {
+	return map[string]string{
+		"x-api-key":         g.config.APIKey,
+		"anthropic-version": anthropicVersion,
+	}
+}
+
+func (g *anthropic) Generate(ctx context.Context, prompt string) (Completion, error) {
+	var response anthropicResponse
+	if err := postJSON(ctx, g.client, ProviderAnthropic, g.config.BaseURL+"/messages", g.headers(), g.request(prompt, false), &response); err != nil {
+		return Completion{}, err
+	}
+
+	var text strings.Builder
+	for _, block := range response.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	if text.Len() == 0 {
+		return Completion{}, ErrEmptyResponse
+	}
+
+	return Completion{
+		Text:         text.String(),
+		Provider:     ProviderAnthropic,
+		Model:        firstNonEmpty(response.Model, g.config.Model),
+		InputTokens:  response.Usage.InputTokens,
+		OutputTokens: response.Usage.OutputTokens,
+	}, nil
+}
+
+func (g *anthropic) GenerateStream(ctx context.Context, prompt string, onText func(string)) (Completion, error) {
+	resp, err := sendJSON(ctx, g.client, ProviderAnthropic, g.config.BaseURL+"/messages", g.headers(), g.request(prompt, true))
+	if err != nil {
+		return Completion{}, err
+	}
+	defer resp.Body.Close()
+
+	completion := Completion{Provider: ProviderAnthropic, Model: g.config.Model}
+	var text strings.Builder
+	var streamErr error
+	err = readServerSentEvents(resp.Body, func(data string) bool {
+		var event anthropicStreamEvent
+		if streamErr = json.Unmarshal([]byte(data), &event); streamErr != nil {
+			return false
+		}
+		switch event.Type {
+		case "message_start":
+			completion.Model = firstNonEmpty(event.Message.Model, completion.Model)
+			completion.InputTokens = event.Message.Usage.InputTokens
+		case "content_block_delta":
+			if event.Delta.Type == "text_delta" && event.Delta.Text != "" {
+				text.WriteString(event.Delta.Text)
+				onText(event.Delta.Text)
+			}
+		case "message_delta":
+			completion.OutputTokens = event.Usage.OutputTokens
+		case "error":
+			streamErr = errors.New("anthropic stream error: " + event.Error.Message)
+			return false
+		case "message_stop":
+			return false
+		}
+		return true
+	})
+	if err == nil {
+		err = streamErr
+	}
+	if err != nil {
+		return Completion{}, err
+	}
+
+	if text.Len() == 0 {
+		return Completion{}, ErrEmptyResponse
+	}
+	completion.Text = text.String()
+	return completion, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
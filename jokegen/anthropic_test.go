@@ -0,0 +1,121 @@
+package jokegen
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestAnthropicGenerate(t *testing.T) {
+	server, received := fakeProvider(t, 200, `{
+		"model": "test-model-2024",
+		"content": [
+			{"type": "text", "text": "Joke one\n"},
+			{"type": "tool_use"},
+			{"type": "text", "text": "Joke two"}
+		],
+		"usage": {"input_tokens": 12, "output_tokens": 34}
+	}`)
+	generator := newTestGenerator(t, ProviderAnthropic, server.URL)
+
+	completion, err := generator.Generate(context.Background(), "Tell jokes")
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	want := Completion{Text: "Joke one\nJoke two", Provider: ProviderAnthropic, Model: "test-model-2024", InputTokens: 12, OutputTokens: 34}
+	if completion != want {
+		t.Errorf("completion = %+v, want %+v", completion, want)
+	}
+
+	if received.Path != "/messages" || received.Header.Get("x-api-key") != "secret" || received.Header.Get("anthropic-version") != anthropicVersion {
+		t.Errorf("request to %s with headers %v", received.Path, received.Header)
+	}
+	body := received.Body
+	messages, _ := body["messages"].([]interface{})
+	if body["model"] != "test-model" || body["temperature"] != 0.5 || body["max_tokens"] != float64(100) || len(messages) != 1 {
+		t.Fatalf("request body = %v", body)
+	}
+	if message := messages[0].(map[string]interface{}); message["role"] != "user" || message["content"] != "Tell jokes" {
+		t.Errorf("message = %v", message)
+	}
+}
+
+func TestAnthropicCapsTemperature(t *testing.T) {
+	server, received := fakeProvider(t, 200, `{"content": [{"type": "text", "text": "Joke"}]}`)
+	generator, err := New(Config{Provider: ProviderAnthropic, BaseURL: server.URL, APIKey: "secret", Temperature: 1.5})
+	if err != nil {
+		t.Fatalf("new generator: %v", err)
+	}
+
+	completion, err := generator.Generate(context.Background(), "Tell jokes")
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if received.Body["temperature"] != float64(1) || completion.Model != "claude-3-5-haiku-latest" {
+		t.Errorf("temperature = %v, model = %q; want 1 and the default model", received.Body["temperature"], completion.Model)
+	}
+}
+
+func TestAnthropicGenerateEmpty(t *testing.T) {
+	server, _ := fakeProvider(t, 200, `{"content": [{"type": "tool_use"}]}`)
+	generator := newTestGenerator(t, ProviderAnthropic, server.URL)
+
+	if _, err := generator.Generate(context.Background(), "Tell jokes"); !errors.Is(err, ErrEmptyResponse) {
+		t.Fatalf("err = %v, want ErrEmptyResponse", err)
+	}
+}
+
+func TestAnthropicStream(t *testing.T) {
+	server, received := fakeProvider(t, 200, strings.Join([]string{
+		`event: message_start`,
+		`data: {"type":"message_start","message":{"model":"test-model-2024","usage":{"input_tokens":12}}}`,
+		``,
+		`event: content_block_delta`,
+		`data: {"type":"content_block_delta","delta":{"type":"text_delta","text":"Joke "}}`,
+		``,
+		`event: ping`,
+		`data: {"type":"ping"}`,
+		``,
+		`event: content_block_delta`,
+		`data: {"type":"content_block_delta","delta":{"type":"text_delta","text":"one\nJoke two"}}`,
+		``,
+		`event: message_delta`,
+		`data: {"type":"message_delta","usage":{"output_tokens":34}}`,
+		``,
+		`event: message_stop`,
+		`data: {"type":"message_stop"}`,
+		``,
+	}, "\n"))
+	generator := newTestGenerator(t, ProviderAnthropic, server.URL)
+
+	completion, pieces, err := streamAll(t, generator)
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	want := Completion{Text: "Joke one\nJoke two", Provider: ProviderAnthropic, Model: "test-model-2024", InputTokens: 12, OutputTokens: 34}
+	if completion != want || strings.Join(pieces, "|") != "Joke |one\nJoke two" {
+		t.Errorf("completion = %+v, pieces = %q; want %+v", completion, pieces, want)
+	}
+	if received.Body["stream"] != true {
+		t.Errorf("request body = %v, want a stream", received.Body)
+	}
+}
+
+func TestAnthropicStreamErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"error event", "data: {\"type\":\"error\",\"error\":{\"message\":\"Overloaded\"}}\n\n", "anthropic stream error: Overloaded"},
+		{"no text", "data: {\"type\":\"message_stop\"}\n\n", ErrEmptyResponse.Error()},
+	}
+	for _, tt := range tests {
+		server, _ := fakeProvider(t, 200, tt.body)
+		_, _, err := streamAll(t, newTestGenerator(t, ProviderAnthropic, server.URL))
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%s: err = %v, want %s", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package jokegen
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+// Fake is a deterministic JokeGenerator for tests and local development. It
+// returns Jokes when set, otherwise five jokes derived from the prompt, and
+// fails with Err when set. Token counts are word counts.
+type Fake struct {
+	Jokes []string
+	Err   error
+}
+
+// NewFake returns a Fake that derives its jokes from the prompt
+func NewFake() *Fake {
+	return &Fake{}
+}
+
+// GenerateStream delivers the fake completion one line at a time
+func (f *Fake) GenerateStream(ctx context.Context, prompt string, onText func(string)) (Completion, error) {
+	completion, err := f.Generate(ctx, prompt)
+	if err != nil {
+		return Completion{}, err
+	}
+	for _, line := range strings.SplitAfter(completion.Text, "\n") {
+		onText(line)
+	}
+	return completion, nil
+}
+
+func (f *Fake) Generate(ctx context.Context, prompt string) (Completion, error) {
+	if err := ctx.Err(); err != nil {
+		return Completion{}, err
+	}
+	if f.Err != nil {
+		return Completion{}, f.Err
+	}
+
+	jokes := f.Jokes
+	if len(jokes) == 0 {
+		hash := fnv.New32a()
+		hash.Write([]byte(prompt))
+		seed := hash.Sum32()
+
+		jokes = make([]string, 5)
+		for i := range jokes {
+			jokes[i] = fmt.Sprintf("Fake joke %d (%08x)", i+1, seed+uint32(i))
+		}
+	}
+
+	text := strings.Join(jokes, "\n")
+	return Completion{
+		Text:         text,
+		Provider:     ProviderFake,
+		Model:        ProviderFake,
+		InputTokens:  len(strings.Fields(prompt)),
+		OutputTokens: len(strings.Fields(text)),
+	}, nil
+}
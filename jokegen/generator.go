@@ -0,0 +1,169 @@
+// Package jokegen generates jokes with a large language model. The handlers
+// depend only on the JokeGenerator interface; the vendor, model and sampling
+// parameters are chosen by configuration.
+package jokegen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Provider names accepted in Config.Provider
+const (
+	ProviderOpenAI    = "openai"
+	ProviderAnthropic = "anthropic"
+	ProviderOllama    = "ollama"
+	ProviderFake      = "fake"
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown joke provider")
+	ErrMissingAPIKey   = errors.New("joke provider API key is not set")
+	ErrEmptyResponse   = errors.New("joke provider returned no content")
+)
+
+// JokeGenerator turns a prompt into the model's raw text completion
+type JokeGenerator interface {
+	Generate(ctx context.Context, prompt string) (Completion, error)
+}
+
+// Completion is the text a model produced and what producing it cost
+type Completion struct {
+	Text         string
+	Provider     string
+	Model        string
+	InputTokens  int
+	OutputTokens int
+}
+
+// Config selects and tunes a JokeGenerator
+type Config struct {
+	Provider    string
+	Model       string
+	BaseURL     string
+	APIKey      string
+	Temperature float64
+	MaxTokens   int
+	Timeout     time.Duration
+}
+
+// ConfigFromEnv reads the JOKE_* environment variables. The provider
+// defaults to OpenAI with gpt-4o, matching the original behaviour.
+func ConfigFromEnv() Config {
+	config := Config{
+		Provider:    strings.ToLower(strings.TrimSpace(os.Getenv("JOKE_PROVIDER"))),
+		Model:       os.Getenv("JOKE_MODEL"),
+		BaseURL:     strings.TrimRight(os.Getenv("JOKE_BASE_URL"), "/"),
+		Temperature: 0.7,
+		MaxTokens:   1024,
+		Timeout:     30 * time.Second,
+	}
+	if config.Provider == "" {
+		config.Provider = ProviderOpenAI
+	}
+
+	switch config.Provider {
+	case ProviderOpenAI:
+		config.APIKey = os.Getenv("OPENAI_API_KEY")
+	case ProviderAnthropic:
+		config.APIKey = os.Getenv("ANTHROPIC_API_KEY")
+	}
+
+	if value, err := strconv.ParseFloat(os.Getenv("JOKE_TEMPERATURE"), 64); err == nil {
+		config.Temperature = value
+	}
+	if value, err := strconv.Atoi(os.Getenv("JOKE_MAX_TOKENS")); err == nil && value > 0 {
+		config.MaxTokens = value
+	}
+	if value, err := time.ParseDuration(os.Getenv("JOKE_TIMEOUT")); err == nil && value > 0 {
+		config.Timeout = value
+	}
+
+	return config
+}
+
+// New returns the generator for the configured provider
+func New(config Config) (JokeGenerator, error) {
+	client := &http.Client{Timeout: config.Timeout}
+
+	switch config.Provider {
+	case ProviderOpenAI:
+		if config.APIKey == "" && config.BaseURL == "" {
+			return nil, ErrMissingAPIKey
+		}
+		return newOpenAI(config, client), nil
+	case ProviderAnthropic:
+		if config.APIKey == "" {
+			return nil, ErrMissingAPIKey
+		}
+		return newAnthropic(config, client), nil
+	case ProviderOllama:
+		return newOllama(config, client), nil
+	case ProviderFake:
+		return NewFake(), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownProvider, config.Provider)
+	}
+}
+
+// APIError is returned when a provider answers with a non-2xx status
+type APIError struct {
+	Provider   string
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s returned status %d: %s", e.Provider, e.StatusCode, e.Body)
+}
+
+// postJSON sends a JSON request and decodes a JSON response into out
+func postJSON(ctx context.Context, client *http.Client, provider, url string, headers map[string]string, body, out interface{}) error {
+	resp, err := sendJSON(ctx, client, provider, url, headers, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// sendJSON sends a JSON request and returns the response if it succeeded.
+// The caller must close the response body.
+func sendJSON(ctx context.Context, client *http.Client, provider, url string, headers map[string]string, body interface{}) (*http.Response, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, &APIError{Provider: provider, StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(message))}
+	}
+
+	return resp, nil
+}
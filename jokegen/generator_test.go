@@ -0,0 +1,124 @@
+package jokegen
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// providerRequest is what a fake provider received
+type providerRequest struct {
+	Path   string
+	Header http.Header
+	Body   map[string]interface{}
+}
+
+// fakeProvider answers every request with status and body and records the
+// last request
+func fakeProvider(t *testing.T, status int, body string) (*httptest.Server, *providerRequest) {
+	t.Helper()
+	received := &providerRequest{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		received.Path = r.URL.Path
+		received.Header = r.Header.Clone()
+		received.Body = nil
+		if err := json.Unmarshal(data, &received.Body); err != nil {
+			t.Errorf("request body is not JSON: %s", data)
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server, received
+}
+
+func newTestGenerator(t *testing.T, provider, baseURL string) JokeGenerator {
+	t.Helper()
+	generator, err := New(Config{
+		Provider:    provider,
+		Model:       "test-model",
+		BaseURL:     baseURL,
+		APIKey:      "secret",
+		Temperature: 0.5,
+		MaxTokens:   100,
+		Timeout:     5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new %s generator: %v", provider, err)
+	}
+	return generator
+}
+
+// streamAll streams a completion and returns it with the pieces onText saw
+func streamAll(t *testing.T, generator JokeGenerator) (Completion, []string, error) {
+	t.Helper()
+	var pieces []string
+	completion, err := Stream(context.Background(), generator, "Tell jokes", func(text string) {
+		pieces = append(pieces, text)
+	})
+	return completion, pieces, err
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		err    error
+	}{
+		{"openai without a key", Config{Provider: ProviderOpenAI}, ErrMissingAPIKey},
+		{"openai compatible server", Config{Provider: ProviderOpenAI, BaseURL: "http://localhost:8000/v1"}, nil},
+		{"anthropic without a key", Config{Provider: ProviderAnthropic, BaseURL: "http://localhost"}, ErrMissingAPIKey},
+		{"ollama", Config{Provider: ProviderOllama}, nil},
+		{"fake", Config{Provider: ProviderFake}, nil},
+		{"unknown", Config{Provider: "gemini"}, ErrUnknownProvider},
+	}
+	for _, tt := range tests {
+		_, err := New(tt.config)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestAPIErrorKeepsStatusAndBody(t *testing.T) {
+	for _, provider := range []string{ProviderOpenAI, ProviderAnthropic, ProviderOllama} {
+		server, _ := fakeProvider(t, 429, `{"error":"slow down"}`)
+		generator := newTestGenerator(t, provider, server.URL)
+
+		_, err := generator.Generate(context.Background(), "Tell jokes")
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.Provider != provider || apiErr.StatusCode != 429 || apiErr.Body != `{"error":"slow down"}` {
+			t.Errorf("%s: Generate err = %v, want the 429 as an APIError", provider, err)
+		}
+
+		_, _, err = streamAll(t, generator)
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != 429 {
+			t.Errorf("%s: Stream err = %v, want the 429 as an APIError", provider, err)
+		}
+	}
+}
+
+func TestFakeGenerator(t *testing.T) {
+	fake := NewFake()
+	first, err := fake.Generate(context.Background(), "cats")
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	again, _ := fake.Generate(context.Background(), "cats")
+	other, _ := fake.Generate(context.Background(), "dogs")
+	if first.Text != again.Text || first.Text == other.Text || strings.Count(first.Text, "\n") != 4 {
+		t.Fatalf("fake jokes are not five lines derived from the prompt: %q, %q", first.Text, other.Text)
+	}
+
+	fake.Err = errors.New("boom")
+	if _, _, err := streamAll(t, fake); err == nil || err.Error() != "boom" {
+		t.Fatalf("stream err = %v, want boom", err)
+	}
+}
@@ -0,0 +1,249 @@
+package jokegen
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// MaxLanguagesPerRequest bounds how many languages one request can generate,
+// since every language is a separate model call
+const MaxLanguagesPerRequest = 5
+
+var (
+	ErrUnsupportedLanguage = errors.New("unsupported language")
+	ErrTooManyLanguages    = fmt.Errorf("at most %d languages can be requested at once", MaxLanguagesPerRequest)
+)
+
+// Text directions of a script
+const (
+	DirectionLTR = "ltr"
+	DirectionRTL = "rtl"
+)
+
+// Language is a language jokes can be generated in. Code is a BCP-47 tag,
+// Script an ISO 15924 code and Prompt a format string taking the user's
+// words.
+type Language struct {
+	Code      string `json:"code"`
+	Name      string `json:"name"`
+	Script    string `json:"script"`
+	Direction string `json:"direction"`
+	Prompt    string `json:"-"`
+}
+
+// PromptFor returns the prompt asking for jokes about the words
+func (l Language) PromptFor(words string) string {
+	return fmt.Sprintf(l.Prompt, words)
+}
+
+// languages is every language with a prompt template, keyed by its tag
+var languages = map[string]Language{}
+
+func init() {
+	for _, language := range []Language{
+		{
+			Code: "en", Name: "English", Script: "Latn", Direction: DirectionLTR,
+			Prompt: "Generate 5 funny jokes or puns based on these words: %s. Make them funny, creative, and humorous. Return only the jokes, one per line.",
+		},
+		{
+			Code: "hi", Name: "Hindi", Script: "Deva", Direction: DirectionLTR,
+			Prompt: "Generate 5 funny jokes or puns in Hindi (using Devanagari script) based on these words: %s. Make them funny, creative, and humorous. Return only the jokes, one per line.",
+		},
+		{
+			Code: "es", Name: "Spanish", Script: "Latn", Direction: DirectionLTR,
+			Prompt: "Generate 5 funny jokes or puns in Spanish based on these words: %s. Use wordplay that works in Spanish rather than translated English jokes. Return only the jokes, one per line.",
+		},
+		{
+			Code: "fr", Name: "French", Script: "Latn", Direction: DirectionLTR,
+			Prompt: "Generate 5 funny jokes or puns in French based on these words: %s. Use wordplay that works in French rather than translated English jokes. Return only the jokes, one per line.",
+		},
+		{
+			Code: "de", Name: "German", Script: "Latn", Direction: DirectionLTR,
+			Prompt: "Generate 5 funny jokes or puns in German based on these words: %s. Use wordplay that works in German rather than translated English jokes. Return only the jokes, one per line.",
+		},
+		{
+			Code: "pt", Name: "Portuguese", Script: "Latn", Direction: DirectionLTR,
+			Prompt: "Generate 5 funny jokes or puns in Portuguese based on these words: %s. Use wordplay that works in Portuguese rather than translated English jokes. Return only the jokes, one per line.",
+		},
+		{
+			Code: "ta", Name: "Tamil", Script: "Taml", Direction: DirectionLTR,
+			Prompt: "Generate 5 funny jokes or puns in Tamil (using Tamil script) based on these words: %s. Make them funny, creative, and humorous. Return only the jokes, one per line.",
+		},
+		{
+			Code: "bn", Name: "Bengali", Script: "Beng", Direction: DirectionLTR,
+			Prompt: "Generate 5 funny jokes or puns in Bengali (using Bengali script) based on these words: %s. Make them funny, creative, and humorous. Return only the jokes, one per line.",
+		},
+		{
+			Code: "ja", Name: "Japanese", Script: "Jpan", Direction: DirectionLTR,
+			Prompt: "Generate 5 funny jokes or puns (dajare) in natural Japanese, using kanji and kana, based on these words: %s. Return only the jokes, one per line.",
+		},
+		{
+			Code: "zh-Hans", Name: "Chinese (Simplified)", Script: "Hans", Direction: DirectionLTR,
+			Prompt: "Generate 5 funny jokes or puns in Chinese (using Simplified Chinese characters) based on these words: %s. Return only the jokes, one per line.",
+		},
+		{
+			Code: "ar", Name: "Arabic", Script: "Arab", Direction: DirectionRTL,
+			Prompt: "Generate 5 funny jokes or puns in Modern Standard Arabic (using Arabic script) based on these words: %s. Return only the jokes, one per line.",
+		},
+	} {
+		languages[language.Code] = language
+	}
+}
+
+// languageAliases maps common tags without a prompt of their own to the
+// language they are written in. Chinese is usually tagged by region, and
+// plain "zh" or a mainland region means Simplified characters. An empty
+// target refuses the tag instead of falling back to its primary language, so
+// Traditional Chinese is not answered in Simplified characters.
+var languageAliases = map[string]string{
+	"zh":      "zh-Hans",
+	"zh-CN":   "zh-Hans",
+	"zh-SG":   "zh-Hans",
+	"zh-Hant": "",
+	"zh-TW":   "",
+	"zh-HK":   "",
+	"zh-MO":   "",
+}
+
+// LookupLanguage finds the language for a BCP-47 tag. Tags are matched case
+// insensitively, and a tag with a region or other subtags falls back to its
+// primary language, so "es-MX" uses the Spanish prompts and "zh-CN" the
+// Simplified Chinese ones.
+func LookupLanguage(tag string) (Language, bool) {
+	subtags := strings.Split(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"), "-")
+	for i := len(subtags); i > 0; i-- {
+		code := canonicalTag(subtags[:i])
+		if target, ok := languageAliases[code]; ok {
+			if target == "" {
+				return Language{}, false
+			}
+			code = target
+		}
+		if language, ok := languages[code]; ok {
+			return language, true
+		}
+	}
+	return Language{}, false
+}
+
+// canonicalTag formats subtags in the conventional BCP-47 case: lowercase
+// language, title case script and uppercase region
+func canonicalTag(subtags []string) string {
+	parts := make([]string, len(subtags))
+	for i, subtag := range subtags {
+		switch {
+		case i == 0:
+			parts[i] = strings.ToLower(subtag)
+		case len(subtag) == 4:
+			parts[i] = strings.ToUpper(subtag[:1]) + strings.ToLower(subtag[1:])
+		case len(subtag) == 2:
+			parts[i] = strings.ToUpper(subtag)
+		default:
+			parts[i] = strings.ToLower(subtag)
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// LanguageSet is the languages a deployment offers and the ones generated
+// when a request does not choose
+type LanguageSet struct {
+	Allowed []Language
+	Default []Language
+}
+
+// DefaultLanguageSet offers English and Hindi, the original languages
+func DefaultLanguageSet() LanguageSet {
+	english, _ := LookupLanguage("en")
+	hindi, _ := LookupLanguage("hi")
+	return LanguageSet{
+		Allowed: []Language{english, hindi},
+		Default: []Language{english, hindi},
+	}
+}
+
+// LanguageSetFromEnv reads the comma separated JOKE_LANGUAGES allow-list and
+// JOKE_DEFAULT_LANGUAGES. Without JOKE_LANGUAGES English and Hindi are
+// offered; without a default the first MaxLanguagesPerRequest allowed
+// languages are generated.
+func LanguageSetFromEnv() (LanguageSet, error) {
+	set := DefaultLanguageSet()
+
+	if value := os.Getenv("JOKE_LANGUAGES"); value != "" {
+		allowed, err := lookupLanguages(splitTags(value))
+		if err != nil {
+			return LanguageSet{}, err
+		}
+		set = LanguageSet{Allowed: allowed, Default: allowed[:min(len(allowed), MaxLanguagesPerRequest)]}
+	}
+
+	if value := os.Getenv("JOKE_DEFAULT_LANGUAGES"); value != "" {
+		defaults, err := set.Resolve(splitTags(value))
+		if err != nil {
+			return LanguageSet{}, fmt.Errorf("JOKE_DEFAULT_LANGUAGES: %w", err)
+		}
+		set.Default = defaults
+	}
+	return set, nil
+}
+
+// Resolve returns the requested languages in order, without duplicates, or
+// the defaults when none are requested. Every tag must be allowed.
+func (s LanguageSet) Resolve(tags []string) ([]Language, error) {
+	if len(tags) == 0 {
+		return s.Default, nil
+	}
+
+	requested, err := lookupLanguages(tags)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, language := range requested {
+		if !s.allows(language) {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedLanguage, language.Code)
+		}
+	}
+	if len(requested) > MaxLanguagesPerRequest {
+		return nil, ErrTooManyLanguages
+	}
+	return requested, nil
+}
+
+func (s LanguageSet) allows(language Language) bool {
+	for _, allowed := range s.Allowed {
+		if allowed.Code == language.Code {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupLanguages maps tags to languages, dropping duplicates
+func lookupLanguages(tags []string) ([]Language, error) {
+	var result []Language
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		language, ok := LookupLanguage(tag)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedLanguage, strings.TrimSpace(tag))
+		}
+		if !seen[language.Code] {
+			seen[language.Code] = true
+			result = append(result, language)
+		}
+	}
+	return result, nil
+}
+
+func splitTags(value string) []string {
+	var tags []string
+	for _, tag := range strings.Split(value, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
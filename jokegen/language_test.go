@@ -0,0 +1,110 @@
+package jokegen
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func codes(languages []Language) []string {
+	result := []string{}
+	for _, language := range languages {
+		result = append(result, language.Code)
+	}
+	return result
+}
+
+func TestLookupLanguage(t *testing.T) {
+	tests := []struct {
+		tag  string
+		code string
+		ok   bool
+	}{
+		{"en", "en", true},
+		{" EN ", "en", true},
+		{"es-MX", "es", true},
+		{"pt_br", "pt", true},
+		{"zh-Hans", "zh-Hans", true},
+		{"zh-hans-cn", "zh-Hans", true},
+		{"zh", "zh-Hans", true},
+		{"zh-CN", "zh-Hans", true},
+		{"zh-cn", "zh-Hans", true},
+		{"zh-SG", "zh-Hans", true},
+		{"zh-TW", "", false},
+		{"zh-Hant-HK", "", false},
+		{"ko", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		language, ok := LookupLanguage(tt.tag)
+		if ok != tt.ok || language.Code != tt.code {
+			t.Errorf("LookupLanguage(%q) = %q, %v; want %q, %v", tt.tag, language.Code, ok, tt.code, tt.ok)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	allowed, err := lookupLanguages([]string{"en", "hi", "es", "fr", "de", "pt", "zh-Hans"})
+	if err != nil {
+		t.Fatalf("lookup languages: %v", err)
+	}
+	set := LanguageSet{Allowed: allowed, Default: allowed[:2]}
+
+	tests := []struct {
+		name  string
+		tags  []string
+		codes []string
+		err   error
+	}{
+		{"defaults", nil, []string{"en", "hi"}, nil},
+		{"in request order", []string{"fr", "en"}, []string{"fr", "en"}, nil},
+		{"duplicates", []string{"es", "ES", "es-MX", "en"}, []string{"es", "en"}, nil},
+		{"region fallback", []string{"pt-BR"}, []string{"pt"}, nil},
+		{"chinese aliases", []string{"zh", "zh-CN"}, []string{"zh-Hans"}, nil},
+		{"unknown tag", []string{"en", "xx"}, nil, ErrUnsupportedLanguage},
+		{"known but not allowed", []string{"ja"}, nil, ErrUnsupportedLanguage},
+		{"five", []string{"en", "hi", "es", "fr", "de"}, []string{"en", "hi", "es", "fr", "de"}, nil},
+		{"too many", []string{"en", "hi", "es", "fr", "de", "pt"}, nil, ErrTooManyLanguages},
+		{"duplicates do not count", []string{"en", "hi", "es", "fr", "de", "en-GB"}, []string{"en", "hi", "es", "fr", "de"}, nil},
+	}
+	for _, tt := range tests {
+		languages, err := set.Resolve(tt.tags)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(codes(languages), tt.codes) {
+			t.Errorf("%s: languages = %v, want %v", tt.name, codes(languages), tt.codes)
+		}
+	}
+}
+
+func TestLanguageSetFromEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		allowed  string
+		defaults string
+		want     []string
+		err      error
+	}{
+		{"unset", "", "", []string{"en", "hi"}, nil},
+		{"allow-list", "fr, de", "", []string{"fr", "de"}, nil},
+		{"long allow-list", "en,hi,es,fr,de,pt,ta,bn", "", []string{"en", "hi", "es", "fr", "de"}, nil},
+		{"explicit defaults", "en,hi,es,fr,de,pt,ta,bn", "bn,ta", []string{"bn", "ta"}, nil},
+		{"defaults outside the allow-list", "en,hi", "es", nil, ErrUnsupportedLanguage},
+		{"too many defaults", "en,hi,es,fr,de,pt", "en,hi,es,fr,de,pt", nil, ErrTooManyLanguages},
+		{"unknown allowed tag", "en,xx", "", nil, ErrUnsupportedLanguage},
+	}
+	for _, tt := range tests {
+		t.Setenv("JOKE_LANGUAGES", tt.allowed)
+		t.Setenv("JOKE_DEFAULT_LANGUAGES", tt.defaults)
+		set, err := LanguageSetFromEnv()
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(codes(set.Default), tt.want) {
+			t.Errorf("%s: defaults = %v, want %v", tt.name, codes(set.Default), tt.want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package jokegen
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ollama talks to a local Ollama server through its native chat API. For a
+// llama.cpp server use the openai provider with its /v1 URL instead.
+type ollama struct {
+	config Config
+	client *http.Client
+}
+
+type ollamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []openAIMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+	Options  ollamaOptions   `json:"options"`
+}
+
+type ollamaOptions struct {
+	Temperature float64 `json:"temperature"`
+	NumPredict  int     `json:"num_predict,omitempty"`
+}
+
+type ollamaResponse struct {
+	Model   string `json:"model"`
+	Message struct {
+		Content string `json:"content"`
+	} `json:"message"`
+	Done            bool   `json:"done"`
+	PromptEvalCount int    `json:"prompt_eval_count"`
+	EvalCount       int    `json:"eval_count"`
+	Error           string `json:"error"`
+}
+
+func newOllama(config Config, client *http.Client) *ollama {
+	if config.BaseURL == "" {
+		config.BaseURL = "http://localhost:11434"
+	}
+	if config.Model == "" {
+		config.Model = "llama3.1"
+	}
+	return &ollama{config: config, client: client}
+}
+
+func (g *ollama) request(prompt string, stream bool) ollamaRequest {
+	return ollamaRequest{
+		Model:    g.config.Model,
+		Messages: []openAIMessage{{Role: "user", Content: prompt}},
+		Stream:   stream,
+		Options: ollamaOptions{
+			Temperature: g.config.Temperature,
+			NumPredict:  g.config.MaxTokens,
+		},
+	}
+}
+
+func (g *ollama) Generate(ctx context.Context, prompt string) (Completion, error) {
+	var response ollamaResponse
+	if err := postJSON(ctx, g.client, ProviderOllama, g.config.BaseURL+"/api/chat", nil, g.request(prompt, false), &response); err != nil {
+		return Completion{}, err
+	}
+
+	if response.Message.Content == "" {
+		return Completion{}, ErrEmptyResponse
+	}
+	return Completion{
+		Text:         response.Message.Content,
+		Provider:     ProviderOllama,
+		Model:        firstNonEmpty(response.Model, g.config.Model),
+		InputTokens:  response.PromptEvalCount,
+		OutputTokens: response.EvalCount,
+	}, nil
+}
+
+// GenerateStream reads Ollama's stream, which is one JSON object per line
+// rather than server-sent events. Usage is reported on the final object.
+func (g *ollama) GenerateStream(ctx context.Context, prompt string, onText func(string)) (Completion, error) {
+	resp, err := sendJSON(ctx, g.client, ProviderOllama, g.config.BaseURL+"/api/chat", nil, g.request(prompt, true))
+	if err != nil {
+		return Completion{}, err
+	}
+	defer resp.Body.Close()
+
+	completion := Completion{Provider: ProviderOllama, Model: g.config.Model}
+	var text strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		var chunk ollamaResponse
+		if err := json.Unmarshal(scanner.Bytes(), &chunk); err != nil {
+			return Completion{}, err
+		}
+		if chunk.Error != "" {
+			return Completion{}, errors.New("ollama stream error: " + chunk.Error)
+		}
+		if chunk.Message.Content != "" {
+			text.WriteString(chunk.Message.Content)
+			onText(chunk.Message.Content)
+		}
+		if chunk.Done {
+			completion.Model = firstNonEmpty(chunk.Model, completion.Model)
+			completion.InputTokens = chunk.PromptEvalCount
+			completion.OutputTokens = chunk.EvalCount
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Completion{}, err
+	}
+
+	if text.Len() == 0 {
+		return Completion{}, ErrEmptyResponse
+	}
+	completion.Text = text.String()
+	return completion, nil
+}
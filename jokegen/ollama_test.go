@@ -0,0 +1,87 @@
+package jokegen
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestOllamaGenerate(t *testing.T) {
+	server, received := fakeProvider(t, 200, `{
+		"model": "test-model:8b",
+		"message": {"role": "assistant", "content": "Joke one\nJoke two"},
+		"done": true,
+		"prompt_eval_count": 12,
+		"eval_count": 34
+	}`)
+	generator := newTestGenerator(t, ProviderOllama, server.URL)
+
+	completion, err := generator.Generate(context.Background(), "Tell jokes")
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	want := Completion{Text: "Joke one\nJoke two", Provider: ProviderOllama, Model: "test-model:8b", InputTokens: 12, OutputTokens: 34}
+	if completion != want {
+		t.Errorf("completion = %+v, want %+v", completion, want)
+	}
+
+	if received.Path != "/api/chat" || received.Header.Get("Authorization") != "" {
+		t.Errorf("request to %s with Authorization %q", received.Path, received.Header.Get("Authorization"))
+	}
+	body := received.Body
+	options, _ := body["options"].(map[string]interface{})
+	if body["model"] != "test-model" || body["stream"] != false || options["temperature"] != 0.5 || options["num_predict"] != float64(100) {
+		t.Fatalf("request body = %v", body)
+	}
+}
+
+func TestOllamaGenerateEmpty(t *testing.T) {
+	server, _ := fakeProvider(t, 200, `{"message": {"content": ""}, "done": true}`)
+	generator := newTestGenerator(t, ProviderOllama, server.URL)
+
+	if _, err := generator.Generate(context.Background(), "Tell jokes"); !errors.Is(err, ErrEmptyResponse) {
+		t.Fatalf("err = %v, want ErrEmptyResponse", err)
+	}
+}
+
+func TestOllamaStream(t *testing.T) {
+	server, received := fakeProvider(t, 200, strings.Join([]string{
+		`{"model":"test-model:8b","message":{"content":"Joke "},"done":false}`,
+		``,
+		`{"model":"test-model:8b","message":{"content":"one\nJoke two"},"done":false}`,
+		`{"model":"test-model:8b","message":{"content":""},"done":true,"prompt_eval_count":12,"eval_count":34}`,
+		`{"message":{"content":"ignored after done"}}`,
+	}, "\n"))
+	generator := newTestGenerator(t, ProviderOllama, server.URL)
+
+	completion, pieces, err := streamAll(t, generator)
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	want := Completion{Text: "Joke one\nJoke two", Provider: ProviderOllama, Model: "test-model:8b", InputTokens: 12, OutputTokens: 34}
+	if completion != want || strings.Join(pieces, "|") != "Joke |one\nJoke two" {
+		t.Errorf("completion = %+v, pieces = %q; want %+v", completion, pieces, want)
+	}
+	if received.Body["stream"] != true {
+		t.Errorf("request body = %v, want a stream", received.Body)
+	}
+}
+
+func TestOllamaStreamErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"error object", `{"error":"model not found"}`, "ollama stream error: model not found"},
+		{"no text", `{"message":{"content":""},"done":true}`, ErrEmptyResponse.Error()},
+	}
+	for _, tt := range tests {
+		server, _ := fakeProvider(t, 200, tt.body)
+		_, _, err := streamAll(t, newTestGenerator(t, ProviderOllama, server.URL))
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%s: err = %v, want %s", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package jokegen
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// openAI talks to the OpenAI chat completions API or any server compatible
+// with it, such as llama.cpp's server, vLLM or LiteLLM
+type openAI struct {
+	config Config
+	client *http.Client
+}
+
+type openAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIRequest struct {
+	Model         string               `json:"model"`
+	Messages      []openAIMessage      `json:"messages"`
+	Temperature   float64              `json:"temperature"`
+	MaxTokens     int                  `json:"max_tokens,omitempty"`
+	Stream        bool                 `json:"stream,omitempty"`
+	StreamOptions *openAIStreamOptions `json:"stream_options,omitempty"`
+}
+
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+type openAIResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+	} `json:"choices"`
+	Usage openAIUsage `json:"usage"`
+}
+
+type openAIStreamChunk struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Usage *openAIUsage `json:"usage"`
+}
+
+func newOpenAI(config Config, client *http.Client) *openAI {
+	if config.BaseURL == "" {
+		config.BaseURL = "https://api.openai.com/v1"
+	}
+	if config.Model == "" {
+		config.Model = "gpt-4o"
+	}
+	return &openAI{config: config, client: client}
+}
+
+func (g *openAI) request(prompt string, stream bool) openAIRequest {
+	request := openAIRequest{
+		Model:       g.config.Model,
+		Messages:    []openAIMessage{{Role: "user", Content: prompt}},
+		Temperature: g.config.Temperature,
+		MaxTokens:   g.config.MaxTokens,
+		Stream:      stream,
+	}
+	if stream {
+		// Usage is only reported at the end of a stream when asked for
+		request.StreamOptions = &openAIStreamOptions{IncludeUsage: true}
+	}
+	return request
+}
+
+func (g *openAI) headers() map[string]string {
+	headers := map[string]string{}
+	if g.config.APIKey != "" {
+		headers["Authorization"] = "Bearer " + g.config.APIKey
+	}
+	return headers
+}
+
+func (g *openAI) completion(model string) Completion {
+	if model == "" {
+		model = g.config.Model
+	}
+	return Completion{Provider: ProviderOpenAI, Model: model}
+}
+
+func (g *openAI) Generate(ctx context.Context, prompt string) (Completion, error) {
+	var response openAIResponse
+	if err := postJSON(ctx, g.client, ProviderOpenAI, g.config.BaseURL+"/chat/completions", g.headers(), g.request(prompt, false), &response); err != nil {
+		return Completion{}, err
+	}
+
+	if len(response.Choices) == 0 || response.Choices[0].Message.Content == "" {
+		return Completion{}, ErrEmptyResponse
+	}
+
+	completion := g.completion(response.Model)
+	completion.Text = response.Choices[0].Message.Content
+	completion.InputTokens = response.Usage.PromptTokens
+	completion.OutputTokens = response.Usage.CompletionTokens
+	return completion, nil
+}
+
+func (g *openAI) GenerateStream(ctx context.Context, prompt string, onText func(string)) (Completion, error) {
+	resp, err := sendJSON(ctx, g.client, ProviderOpenAI, g.config.BaseURL+"/chat/completions", g.headers(), g.request(prompt, true))
+	if err != nil {
+		return Completion{}, err
+	}
+	defer resp.Body.Close()
+
+	completion := g.completion("")
+	var text strings.Builder
+	var decodeErr error
+	err = readServerSentEvents(resp.Body, func(data string) bool {
+		if data == "[DONE]" {
+			return false
+		}
+		var chunk openAIStreamChunk
+		if decodeErr = json.Unmarshal([]byte(data), &chunk); decodeErr != nil {
+			return false
+		}
+		if chunk.Model != "" {
+			completion.Model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			completion.InputTokens = chunk.Usage.PromptTokens
+			completion.OutputTokens = chunk.Usage.CompletionTokens
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			text.WriteString(chunk.Choices[0].Delta.Content)
+			onText(chunk.Choices[0].Delta.Content)
+		}
+		return true
+	})
+	if err == nil {
+		err = decodeErr
+	}
+	if err != nil {
+		return Completion{}, err
+	}
+
+	if text.Len() == 0 {
+		return Completion{}, ErrEmptyResponse
+	}
+	completion.Text = text.String()
+	return completion, nil
+}
@@ -0,0 +1,93 @@
+package jokegen
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestOpenAIGenerate(t *testing.T) {
+	server, received := fakeProvider(t, 200, `{
+		"model": "test-model-2024",
+		"choices": [{"message": {"content": "Joke one\nJoke two"}}],
+		"usage": {"prompt_tokens": 12, "completion_tokens": 34}
+	}`)
+	generator := newTestGenerator(t, ProviderOpenAI, server.URL)
+
+	completion, err := generator.Generate(context.Background(), "Tell jokes")
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	want := Completion{Text: "Joke one\nJoke two", Provider: ProviderOpenAI, Model: "test-model-2024", InputTokens: 12, OutputTokens: 34}
+	if completion != want {
+		t.Errorf("completion = %+v, want %+v", completion, want)
+	}
+
+	if received.Path != "/chat/completions" || received.Header.Get("Authorization") != "Bearer secret" {
+		t.Errorf("request to %s with Authorization %q", received.Path, received.Header.Get("Authorization"))
+	}
+	body := received.Body
+	messages, _ := body["messages"].([]interface{})
+	if body["model"] != "test-model" || body["temperature"] != 0.5 || body["max_tokens"] != float64(100) || body["stream"] != nil || len(messages) != 1 {
+		t.Fatalf("request body = %v", body)
+	}
+	if message := messages[0].(map[string]interface{}); message["role"] != "user" || message["content"] != "Tell jokes" {
+		t.Errorf("message = %v", message)
+	}
+}
+
+func TestOpenAIGenerateEmpty(t *testing.T) {
+	server, _ := fakeProvider(t, 200, `{"choices": []}`)
+	generator := newTestGenerator(t, ProviderOpenAI, server.URL)
+
+	if _, err := generator.Generate(context.Background(), "Tell jokes"); !errors.Is(err, ErrEmptyResponse) {
+		t.Fatalf("err = %v, want ErrEmptyResponse", err)
+	}
+}
+
+func TestOpenAIStream(t *testing.T) {
+	server, received := fakeProvider(t, 200, strings.Join([]string{
+		`data: {"model":"test-model-2024","choices":[{"delta":{"content":"Joke "}}]}`,
+		``,
+		`data: {"choices":[{"delta":{"content":"one\nJoke two"}}]}`,
+		``,
+		`data: {"choices":[],"usage":{"prompt_tokens":12,"completion_tokens":34}}`,
+		``,
+		`data: [DONE]`,
+		``,
+	}, "\n"))
+	generator := newTestGenerator(t, ProviderOpenAI, server.URL)
+
+	completion, pieces, err := streamAll(t, generator)
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	want := Completion{Text: "Joke one\nJoke two", Provider: ProviderOpenAI, Model: "test-model-2024", InputTokens: 12, OutputTokens: 34}
+	if completion != want || strings.Join(pieces, "|") != "Joke |one\nJoke two" {
+		t.Errorf("completion = %+v, pieces = %q; want %+v", completion, pieces, want)
+	}
+
+	options, _ := received.Body["stream_options"].(map[string]interface{})
+	if received.Body["stream"] != true || options["include_usage"] != true {
+		t.Errorf("request body = %v, want a stream that reports usage", received.Body)
+	}
+}
+
+func TestOpenAIStreamErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		err  error
+	}{
+		{"no text", "data: [DONE]\n\n", ErrEmptyResponse},
+		{"malformed chunk", "data: {not json\n\n", nil},
+	}
+	for _, tt := range tests {
+		server, _ := fakeProvider(t, 200, tt.body)
+		_, _, err := streamAll(t, newTestGenerator(t, ProviderOpenAI, server.URL))
+		if err == nil || (tt.err != nil && !errors.Is(err, tt.err)) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
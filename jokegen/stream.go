@@ -0,0 +1,49 @@
+package jokegen
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+)
+
+// StreamingJokeGenerator is implemented by generators that can deliver the
+// completion as the model produces it
+type StreamingJokeGenerator interface {
+	JokeGenerator
+	GenerateStream(ctx context.Context, prompt string, onText func(string)) (Completion, error)
+}
+
+// Stream generates a completion, passing each piece of text to onText as it
+// arrives, and returns the whole completion. Generators that cannot stream
+// deliver the completion in one piece.
+func Stream(ctx context.Context, generator JokeGenerator, prompt string, onText func(string)) (Completion, error) {
+	if streaming, ok := generator.(StreamingJokeGenerator); ok {
+		return streaming.GenerateStream(ctx, prompt, onText)
+	}
+
+	completion, err := generator.Generate(ctx, prompt)
+	if err != nil {
+		return Completion{}, err
+	}
+	onText(completion.Text)
+	return completion, nil
+}
+
+// readServerSentEvents calls onData with the data of every event in an SSE
+// stream until onData returns false or the stream ends
+func readServerSentEvents(body io.Reader, onData func(string) bool) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		if !onData(strings.TrimSpace(strings.TrimPrefix(line, "data:"))) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
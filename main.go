@@ -6,9 +6,14 @@ import (
 	"log"
 	"os"
 	"strings"
+	"time"
 
+	"go-auth-app/controllers"
+	"go-auth-app/jokegen"
+	"go-auth-app/middlewares"
 	"go-auth-app/models"
 	"go-auth-app/routes"
+	"go-auth-app/utils"
 
 	secretmanager "cloud.google.com/go/secretmanager/apiv1"
 	secretmanagerpb "cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
@@ -36,27 +41,37 @@ func loadSecrets(client *secretmanager.Client) error {
 	secrets := []struct {
 		envName    string
 		secretName string
+		optional   bool
 	}{
-		{"DB_HOST", "projects/706489728076/secrets/DB_HOST/versions/latest"},
-		{"DB_USER", "projects/706489728076/secrets/DB_USER/versions/latest"},
-		{"DB_NAME", "projects/706489728076/secrets/DB_NAME/versions/latest"},
-		{"DB_PASSWORD", "projects/706489728076/secrets/DB_PASSWORD/versions/latest"},
-		{"DB_PORT", "projects/706489728076/secrets/DB_PORT/versions/latest"},
-		{"DB_SSL", "projects/706489728076/secrets/DB_SSL/versions/latest"},
-		{"EMAIL_ADDRESS", "projects/706489728076/secrets/EMAIL_ADDRESS/versions/latest"},
-		{"EMAIL_PASSWORD", "projects/706489728076/secrets/EMAIL_PASSWORD/versions/latest"},
-		{"SMTP_HOST", "projects/706489728076/secrets/SMTP_HOST/versions/latest"},
-		{"SMTP_PORT", "projects/706489728076/secrets/SMTP_PORT/versions/latest"},
-		{"OPENAI_API_KEY", "projects/706489728076/secrets/OPENAI_API_KEY/versions/latest"},
-		{"GOOGLE_OAUTH_REDIRECT_URL", "projects/706489728076/secrets/GOOGLE_OAUTH_REDIRECT_URL/versions/latest"},
-		{"GOOGLE_CLIENT_ID", "projects/706489728076/secrets/GOOGLE_CLIENT_ID/versions/latest"},
-		{"GOOGLE_CLIENT_SECRET", "projects/706489728076/secrets/GOOGLE_CLIENT_SECRET/versions/latest"},
-		{"REACT_FRONTEND_URL", "projects/706489728076/secrets/REACT_FRONTEND_URL/versions/latest"},
+		{"DB_HOST", "projects/706489728076/secrets/DB_HOST/versions/latest", false},
+		{"DB_USER", "projects/706489728076/secrets/DB_USER/versions/latest", false},
+		{"DB_NAME", "projects/706489728076/secrets/DB_NAME/versions/latest", false},
+		{"DB_PASSWORD", "projects/706489728076/secrets/DB_PASSWORD/versions/latest", false},
+		{"DB_PORT", "projects/706489728076/secrets/DB_PORT/versions/latest", false},
+		{"DB_SSL", "projects/706489728076/secrets/DB_SSL/versions/latest", false},
+		{"EMAIL_ADDRESS", "projects/706489728076/secrets/EMAIL_ADDRESS/versions/latest", false},
+		{"EMAIL_PASSWORD", "projects/706489728076/secrets/EMAIL_PASSWORD/versions/latest", false},
+		{"SMTP_HOST", "projects/706489728076/secrets/SMTP_HOST/versions/latest", false},
+		{"SMTP_PORT", "projects/706489728076/secrets/SMTP_PORT/versions/latest", false},
+		{"OPENAI_API_KEY", "projects/706489728076/secrets/OPENAI_API_KEY/versions/latest", true},
+		{"ANTHROPIC_API_KEY", "projects/706489728076/secrets/ANTHROPIC_API_KEY/versions/latest", true},
+		{"GOOGLE_OAUTH_REDIRECT_URL", "projects/706489728076/secrets/GOOGLE_OAUTH_REDIRECT_URL/versions/latest", false},
+		{"GOOGLE_CLIENT_ID", "projects/706489728076/secrets/GOOGLE_CLIENT_ID/versions/latest", false},
+		{"GOOGLE_CLIENT_SECRET", "projects/706489728076/secrets/GOOGLE_CLIENT_SECRET/versions/latest", false},
+		{"OIDC_PROVIDERS", "projects/706489728076/secrets/OIDC_PROVIDERS/versions/latest", true},
+		{"REACT_FRONTEND_URL", "projects/706489728076/secrets/REACT_FRONTEND_URL/versions/latest", false},
+		{"JWT_KEYS", "projects/706489728076/secrets/JWT_KEYS/versions/latest", true},
+		{"JWT_SIGNING_KID", "projects/706489728076/secrets/JWT_SIGNING_KID/versions/latest", true},
+		{"JWT_SECRET", "projects/706489728076/secrets/JWT_SECRET/versions/latest", true},
 	}
 
 	for _, secret := range secrets {
 		value, err := accessSecretVersion(client, secret.secretName)
 		if err != nil {
+			if secret.optional {
+				log.Printf("Skipping optional secret %s: %v", secret.envName, err)
+				continue
+			}
 			return err
 		}
 		os.Setenv(secret.envName, strings.TrimSpace(value))
@@ -88,6 +103,9 @@ func main() {
 	}
 
 	r := gin.Default()
+	if err := middlewares.ConfigureTrustedProxies(r, isProduction); err != nil {
+		log.Fatalf("Failed to configure trusted proxies: %v", err)
+	}
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -109,12 +127,72 @@ func main() {
 
 	models.InitDB(config)
 
+	if adminEmails := os.Getenv("ADMIN_EMAILS"); adminEmails != "" {
+		emails := strings.Split(adminEmails, ",")
+		for i := range emails {
+			emails[i] = strings.TrimSpace(emails[i])
+		}
+		if err := models.PromoteAdmins(models.GetDB(), emails); err != nil {
+			log.Fatalf("Failed to promote admins: %v", err)
+		}
+	}
+
+	if path := os.Getenv("BREACHED_PASSWORDS_FILE"); path != "" {
+		count, err := utils.LoadBreachedPasswords(path)
+		if err != nil {
+			log.Fatalf("Failed to load breached passwords: %v", err)
+		}
+		log.Printf("Loaded %d breached passwords", count)
+	}
+
+	if _, err := utils.Keys(); err != nil {
+		log.Fatalf("Failed to load JWT signing keys: %v", err)
+	}
+
+	jokeGenerator, err := jokegen.New(jokegen.ConfigFromEnv())
+	if err != nil {
+		log.Fatalf("Failed to configure joke generator: %v", err)
+	}
+	controllers.SetJokeGenerator(jokeGenerator)
+
+	jokeLanguages, err := jokegen.LanguageSetFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure joke languages: %v", err)
+	}
+	controllers.SetJokeLanguages(jokeLanguages)
+
+	var rateLimitStore *middlewares.PostgresRateLimitStore
+	if os.Getenv("RATE_LIMIT_BACKEND") == "postgres" {
+		rateLimitStore = middlewares.NewPostgresRateLimitStore(models.GetDB())
+		middlewares.SetRateLimitStore(rateLimitStore)
+	}
+
+	// Periodically drop revocation entries, ceremonies and buckets that have expired
+	go func() {
+		for range time.Tick(time.Hour) {
+			if err := utils.PruneRevokedTokens(); err != nil {
+				log.Printf("Failed to prune revoked tokens: %v", err)
+			}
+			if err := utils.PruneWebAuthnSessions(); err != nil {
+				log.Printf("Failed to prune webauthn sessions: %v", err)
+			}
+			if err := utils.PruneAuthCodes(); err != nil {
+				log.Printf("Failed to prune auth codes: %v", err)
+			}
+			if rateLimitStore != nil {
+				if err := rateLimitStore.Prune(24 * time.Hour); err != nil {
+					log.Printf("Failed to prune rate limit buckets: %v", err)
+				}
+			}
+		}
+	}()
+
 	// CORS middleware
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000", "https://jokemaster-go.netlify.app", "https://golang-deploy-448219.uc.r.appspot.com"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Anonymous-Id"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Anonymous-Id", "X-CSRF-Token"},
+		ExposeHeaders:    []string{"Content-Length", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After"},
 		AllowCredentials: true,
 	}))
 
@@ -0,0 +1,19 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// apiKeyScopeKey is the context key AllowAPIKey uses to tell IsAuthorized
+// which scope an API key needs for the route.
+const apiKeyScopeKey = "apiKeyScope"
+
+// AllowAPIKey lets IsAuthorized accept an API key holding the given scope in
+// place of a JWT. Routes without it only accept JWTs. It must run before
+// IsAuthorized.
+func AllowAPIKey(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(apiKeyScopeKey, scope)
+		c.Next()
+	}
+}
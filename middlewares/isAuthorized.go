@@ -1,7 +1,9 @@
 package middlewares
 
 import (
+	"go-auth-app/models"
 	"go-auth-app/utils"
+	"log"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -11,6 +13,15 @@ func IsAuthorized(allowAnonymous bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 
+		// Bearer headers always take precedence so API clients keep working
+		// in cookie mode
+		if authHeader == "" && utils.CookieSessions() {
+			if token, err := c.Cookie(utils.AccessTokenCookie); err == nil && token != "" {
+				authorizeCookie(c, token)
+				return
+			}
+		}
+
 		if authHeader == "" {
 			if allowAnonymous {
 				c.Next()
@@ -45,6 +56,11 @@ func IsAuthorized(allowAnonymous bool) gin.HandlerFunc {
 			return
 		}
 
+		if utils.IsAPIKey(tokenString) {
+			authorizeAPIKey(c, tokenString)
+			return
+		}
+
 		// Parse the token
 		claims, err := utils.ParseJWT(tokenString)
 		if err != nil {
@@ -53,9 +69,77 @@ func IsAuthorized(allowAnonymous bool) gin.HandlerFunc {
 			return
 		}
 
-		// Set user information in context
-		c.Set("email", claims.Email)
-		c.Set("userID", claims.UserID)
+		setClaims(c, claims)
 		c.Next()
 	}
 }
+
+// authorizeCookie authenticates the request with the access token cookie.
+// Browsers attach cookies to cross-site requests too, so requests that
+// change state must echo the CSRF cookie in the X-CSRF-Token header.
+func authorizeCookie(c *gin.Context, token string) {
+	if !utils.IsSafeMethod(c.Request.Method) || c.GetBool(requireCSRFKey) {
+		csrfCookie, _ := c.Cookie(utils.CSRFCookie)
+		csrfToken := c.GetHeader(utils.CSRFHeader)
+		if csrfToken == "" && c.GetBool(requireCSRFKey) {
+			csrfToken = c.Query(utils.CSRFQueryParam)
+		}
+		if !utils.ValidCSRFToken(csrfCookie, csrfToken) {
+			c.JSON(403, gin.H{"error": "Invalid CSRF token"})
+			c.Abort()
+			return
+		}
+	}
+
+	claims, err := utils.ParseJWT(token)
+	if err != nil {
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		c.Abort()
+		return
+	}
+
+	setClaims(c, claims)
+	c.Next()
+}
+
+// setClaims sets user information in the context
+func setClaims(c *gin.Context, claims *models.Claims) {
+	c.Set("email", claims.Email)
+	c.Set("userID", claims.UserID)
+	c.Set("claims", claims)
+	c.Set("role", claims.Role)
+	c.Set("permissions", claims.Permissions)
+
+	if err := utils.TouchSession(claims.SessionID, c.ClientIP()); err != nil {
+		log.Printf("Failed to record session activity: %v", err)
+	}
+}
+
+// authorizeAPIKey authenticates the request with an API key if the route
+// allows one with the scope it requires.
+func authorizeAPIKey(c *gin.Context, key string) {
+	scope := c.GetString(apiKeyScopeKey)
+	if scope == "" {
+		c.JSON(401, gin.H{"error": "API keys are not accepted for this endpoint"})
+		c.Abort()
+		return
+	}
+
+	apiKey, err := utils.AuthenticateAPIKey(key)
+	if err != nil {
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		c.Abort()
+		return
+	}
+
+	if !apiKey.HasScope(scope) {
+		c.JSON(403, gin.H{"error": "API key is missing the " + scope + " scope"})
+		c.Abort()
+		return
+	}
+
+	c.Set("email", apiKey.User.Email)
+	c.Set("userID", apiKey.UserID)
+	c.Set("apiKey", apiKey)
+	c.Next()
+}
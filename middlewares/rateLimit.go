@@ -0,0 +1,227 @@
+package middlewares
+
+import (
+	"fmt"
+	"go-auth-app/models"
+	"log"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RateLimitKeyFunc identifies who a request is counted against
+type RateLimitKeyFunc func(c *gin.Context) string
+
+// RateLimitPolicy is a token bucket holding Limit tokens that refills
+// completely over Period. Each request takes one token.
+type RateLimitPolicy struct {
+	Name   string
+	Limit  int
+	Period time.Duration
+	Key    RateLimitKeyFunc
+}
+
+// RateLimitResult describes the bucket after a request was counted
+type RateLimitResult struct {
+	Allowed    bool
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// RateLimitStore holds bucket state for RateLimit
+type RateLimitStore interface {
+	Take(key string, policy RateLimitPolicy) (RateLimitResult, error)
+}
+
+var (
+	rateLimitStoreMu sync.RWMutex
+	rateLimitStore   RateLimitStore = NewMemoryRateLimitStore()
+)
+
+// SetRateLimitStore replaces the backend used by every RateLimit middleware
+func SetRateLimitStore(store RateLimitStore) {
+	rateLimitStoreMu.Lock()
+	rateLimitStore = store
+	rateLimitStoreMu.Unlock()
+}
+
+// RateLimit rejects requests with 429 once the caller's bucket is empty and
+// reports the bucket state in RateLimit-* headers.
+func RateLimit(policy RateLimitPolicy) gin.HandlerFunc {
+	if policy.Key == nil {
+		policy.Key = KeyByIP
+	}
+
+	return func(c *gin.Context) {
+		rateLimitStoreMu.RLock()
+		store := rateLimitStore
+		rateLimitStoreMu.RUnlock()
+
+		result, err := store.Take(policy.Name+":"+policy.Key(c), policy)
+		if err != nil {
+			// Fail open so an unavailable backend does not take the API down
+			log.Printf("Rate limit check failed: %v", err)
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(policy.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+		c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Limit, ceilSeconds(policy.Period)))
+
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			c.JSON(429, gin.H{"error": "Too many requests. Please try again later."})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// KeyByIP counts requests per client IP. Which headers the IP may come from
+// is decided by ConfigureTrustedProxies.
+func KeyByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// KeyByUserID counts requests per authenticated user, falling back to the
+// client IP. It must run after IsAuthorized.
+func KeyByUserID(c *gin.Context) string {
+	if userID, exists := c.Get("userID"); exists {
+		return fmt.Sprintf("user:%v", userID)
+	}
+	return KeyByIP(c)
+}
+
+// KeyByAnonymousID counts requests per user, then per X-Anonymous-Id, then
+// per client IP.
+func KeyByAnonymousID(c *gin.Context) string {
+	if _, exists := c.Get("userID"); exists {
+		return KeyByUserID(c)
+	}
+	if anonymousID := c.GetHeader("X-Anonymous-Id"); anonymousID != "" {
+		return "anon:" + anonymousID
+	}
+	return KeyByIP(c)
+}
+
+// take refills the bucket for the time elapsed since it was last updated and
+// tries to remove one token.
+func take(tokens float64, updatedAt time.Time, now time.Time, policy RateLimitPolicy) (float64, RateLimitResult) {
+	rate := float64(policy.Limit) / policy.Period.Seconds()
+	tokens = math.Min(float64(policy.Limit), tokens+now.Sub(updatedAt).Seconds()*rate)
+
+	result := RateLimitResult{}
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - tokens) / rate * float64(time.Second))
+	}
+
+	result.Remaining = int(math.Floor(tokens))
+	result.Reset = time.Duration((float64(policy.Limit) - tokens) / rate * float64(time.Second))
+	return tokens, result
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+type memoryBucket struct {
+	tokens    float64
+	updatedAt time.Time
+	period    time.Duration
+}
+
+// MemoryRateLimitStore keeps buckets in process memory. Limits are per
+// instance.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]*memoryBucket), lastSweep: time.Now()}
+}
+
+func (s *MemoryRateLimitStore) Take(key string, policy RateLimitPolicy) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = &memoryBucket{tokens: float64(policy.Limit), updatedAt: now, period: policy.Period}
+		s.buckets[key] = bucket
+	}
+
+	var result RateLimitResult
+	bucket.tokens, result = take(bucket.tokens, bucket.updatedAt, now, policy)
+	bucket.updatedAt = now
+	return result, nil
+}
+
+// sweep drops buckets that have refilled completely and are therefore
+// indistinguishable from new ones.
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	for key, bucket := range s.buckets {
+		if now.Sub(bucket.updatedAt) > bucket.period {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// PostgresRateLimitStore keeps buckets in Postgres so every instance shares
+// the same limits.
+type PostgresRateLimitStore struct {
+	db *gorm.DB
+}
+
+func NewPostgresRateLimitStore(db *gorm.DB) *PostgresRateLimitStore {
+	return &PostgresRateLimitStore{db: db}
+}
+
+func (s *PostgresRateLimitStore) Take(key string, policy RateLimitPolicy) (RateLimitResult, error) {
+	var result RateLimitResult
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		bucket := models.RateLimitBucket{Key: key, Tokens: float64(policy.Limit), UpdatedAt: now}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&bucket).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ?", key).First(&bucket).Error; err != nil {
+			return err
+		}
+
+		bucket.Tokens, result = take(bucket.Tokens, bucket.UpdatedAt, now, policy)
+		bucket.UpdatedAt = now
+		return tx.Save(&bucket).Error
+	})
+
+	return result, err
+}
+
+// Prune deletes buckets that have not been touched for longer than maxAge
+func (s *PostgresRateLimitStore) Prune(maxAge time.Duration) error {
+	return s.db.Where("updated_at < ?", time.Now().Add(-maxAge)).Delete(&models.RateLimitBucket{}).Error
+}
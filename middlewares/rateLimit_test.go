@@ -0,0 +1,59 @@
+package middlewares
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTakeRefillsAndSpendsTokens(t *testing.T) {
+	// One token a second, up to ten
+	policy := RateLimitPolicy{Name: "test", Limit: 10, Period: 10 * time.Second}
+	start := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name       string
+		tokens     float64
+		elapsed    time.Duration
+		left       float64
+		allowed    bool
+		remaining  int
+		reset      time.Duration
+		retryAfter time.Duration
+	}{
+		{"full bucket", 10, 0, 9, true, 9, time.Second, 0},
+		{"refill stops at the limit", 10, time.Hour, 9, true, 9, time.Second, 0},
+		{"fractional tokens round down", 3.7, 0, 2.7, true, 2, 7300 * time.Millisecond, 0},
+		{"last token", 1, 0, 0, true, 0, 10 * time.Second, 0},
+		{"empty bucket", 0, 0, 0, false, 0, 10 * time.Second, time.Second},
+		{"partly refilled", 0, 500 * time.Millisecond, 0.5, false, 0, 9500 * time.Millisecond, 500 * time.Millisecond},
+		{"refilled to one token", 0.5, 500 * time.Millisecond, 0, true, 0, 10 * time.Second, 0},
+	}
+	for _, tt := range tests {
+		left, result := take(tt.tokens, start, start.Add(tt.elapsed), policy)
+		if math.Abs(left-tt.left) > 1e-9 || result.Allowed != tt.allowed || result.Remaining != tt.remaining {
+			t.Errorf("%s: left %v, allowed %v, remaining %d; want %v, %v, %d", tt.name, left, result.Allowed, result.Remaining, tt.left, tt.allowed, tt.remaining)
+		}
+		if (result.Reset-tt.reset).Abs() > time.Millisecond || (result.RetryAfter-tt.retryAfter).Abs() > time.Millisecond {
+			t.Errorf("%s: reset %v, retry after %v; want %v, %v", tt.name, result.Reset, result.RetryAfter, tt.reset, tt.retryAfter)
+		}
+	}
+}
+
+func TestMemoryStoreEnforcesLimitPerKey(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	policy := RateLimitPolicy{Name: "test", Limit: 3, Period: time.Hour}
+
+	for i := 1; i <= 4; i++ {
+		result, err := store.Take("a", policy)
+		if err != nil {
+			t.Fatalf("take: %v", err)
+		}
+		if result.Allowed != (i <= 3) {
+			t.Errorf("request %d: allowed = %v", i, result.Allowed)
+		}
+	}
+	if result, _ := store.Take("b", policy); !result.Allowed || result.Remaining != 2 {
+		t.Errorf("other key: %+v, want a full bucket", result)
+	}
+}
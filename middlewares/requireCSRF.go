@@ -0,0 +1,21 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// requireCSRFKey is the context key RequireCSRF uses to tell IsAuthorized
+// to check the CSRF token even though the request method is safe.
+const requireCSRFKey = "requireCSRF"
+
+// RequireCSRF makes IsAuthorized check the CSRF token of cookie-authenticated
+// GET requests to the route, for GET routes that change state such as the
+// joke stream EventSource opens. EventSource cannot set headers, so the
+// token may also be passed in the csrf_token query parameter. It must run
+// before IsAuthorized.
+func RequireCSRF() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(requireCSRFKey, true)
+		c.Next()
+	}
+}
@@ -0,0 +1,26 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission only lets through users whose role grants every listed
+// permission. It must run after IsAuthorized.
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		granted := make(map[string]bool)
+		for _, permission := range c.GetStringSlice("permissions") {
+			granted[permission] = true
+		}
+
+		for _, permission := range permissions {
+			if !granted[permission] {
+				c.JSON(403, gin.H{"error": "Forbidden"})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
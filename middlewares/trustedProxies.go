@@ -0,0 +1,28 @@
+package middlewares
+
+import (
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ConfigureTrustedProxies decides which headers c.ClientIP may believe. On
+// App Engine the client address comes from X-Appengine-Remote-Addr, which the
+// front end always overwrites. X-Forwarded-For is only honoured when the
+// connection comes from one of the proxies listed in TRUSTED_PROXIES, so
+// clients cannot pick their own IP to dodge per-IP limits.
+func ConfigureTrustedProxies(r *gin.Engine, isProduction bool) error {
+	if isProduction {
+		r.TrustedPlatform = gin.PlatformGoogleAppEngine
+	}
+
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+
+	return r.SetTrustedProxies(proxies)
+}
@@ -0,0 +1,68 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-auth-app/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+func throttleKeyFor(t *testing.T, isProduction bool, headers map[string]string) string {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	if err := ConfigureTrustedProxies(r, isProduction); err != nil {
+		t.Fatalf("ConfigureTrustedProxies: %v", err)
+	}
+	r.GET("/key", func(c *gin.Context) {
+		if KeyByIP(c) != utils.IPThrottleKey(c.ClientIP()) {
+			t.Errorf("rate limit key %q differs from throttle key %q", KeyByIP(c), utils.IPThrottleKey(c.ClientIP()))
+		}
+		c.String(200, utils.IPThrottleKey(c.ClientIP()))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/key", nil)
+	req.RemoteAddr = "203.0.113.7:51234"
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Body.String()
+}
+
+func TestSpoofedForwardedForDoesNotChangeThrottleKey(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "")
+
+	for _, isProduction := range []bool{false, true} {
+		key := throttleKeyFor(t, isProduction, map[string]string{"X-Forwarded-For": "198.51.100.1"})
+		if key != "ip:203.0.113.7" {
+			t.Errorf("production=%v: throttle key = %q, want ip:203.0.113.7", isProduction, key)
+		}
+	}
+}
+
+func TestAppEngineClientIPHeaderIsTrustedInProduction(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "")
+
+	key := throttleKeyFor(t, true, map[string]string{
+		"X-Appengine-Remote-Addr": "192.0.2.10",
+		"X-Forwarded-For":         "198.51.100.1",
+	})
+	if key != "ip:192.0.2.10" {
+		t.Errorf("throttle key = %q, want ip:192.0.2.10", key)
+	}
+}
+
+func TestForwardedForIsTrustedFromConfiguredProxy(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "203.0.113.0/24")
+
+	key := throttleKeyFor(t, false, map[string]string{"X-Forwarded-For": "198.51.100.1"})
+	if key != "ip:198.51.100.1" {
+		t.Errorf("throttle key = %q, want ip:198.51.100.1", key)
+	}
+}
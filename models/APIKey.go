@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// API key scopes
+const (
+	ScopeJokesGenerate = "jokes:generate"
+	ScopeProfileRead   = "profile:read"
+)
+
+// APIKeyScopes lists every scope a key can be granted
+var APIKeyScopes = []string{ScopeJokesGenerate, ScopeProfileRead}
+
+// APIKey is a long-lived credential for scripts. Only the SHA-256 hash of the
+// key is stored; the prefix is kept in clear so users can tell keys apart.
+type APIKey struct {
+	gorm.Model
+	UserID     uint       `gorm:"index" json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `gorm:"uniqueIndex" json:"prefix"`
+	KeyHash    string     `gorm:"uniqueIndex" json:"-"`
+	Scopes     []string   `gorm:"serializer:json" json:"scopes"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	User       User       `gorm:"foreignKey:UserID" json:"-"`
+}
+
+// HasScope reports whether the key was granted the scope
+func (k APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	AuthCodeLogin        = "login"
+	AuthCodeIdentityLink = "identity_link"
+)
+
+// AuthCode is a short-lived, single-use code that is put in a URL in place of
+// a credential, for example when redirecting back to the frontend after a
+// provider login. Only the SHA-256 hash of the code is stored.
+type AuthCode struct {
+	gorm.Model
+	UserID     uint       `gorm:"index" json:"user_id"`
+	Purpose    string     `gorm:"index" json:"purpose"`
+	AuthMethod string     `json:"auth_method"`
+	CodeHash   string     `gorm:"uniqueIndex" json:"-"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	UsedAt     *time.Time `json:"used_at"`
+	User       User       `gorm:"foreignKey:UserID" json:"-"`
+}
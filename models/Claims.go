@@ -1,9 +1,22 @@
 package models
 
-import "github.com/dgrijalva/jwt-go"
+import "github.com/golang-jwt/jwt/v5"
+
+// Token purposes. A token is only accepted where its purpose is expected, so
+// for example an MFA pending token cannot be used as an access token.
+const (
+	PurposeAccess     = "access"
+	PurposeMFAPending = "mfa_pending"
+	PurposeOAuthState = "oauth_state"
+)
 
 type Claims struct {
-	Email  string `json:"email"`
-	UserID uint   `json:"user_id"`
-	jwt.StandardClaims
+	Email       string   `json:"email"`
+	UserID      uint     `json:"user_id"`
+	Purpose     string   `json:"purpose"`
+	Role        string   `json:"role,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	SessionID   uint     `json:"sid,omitempty"`
+	AuthMethod  string   `json:"auth_method,omitempty"`
+	jwt.RegisteredClaims
 }
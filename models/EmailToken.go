@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	EmailTokenPasswordReset = "password_reset"
+	EmailTokenMagicLink     = "magic_link"
+	EmailTokenVerification  = "email_verification"
+	EmailTokenLoginReport   = "login_report"
+)
+
+// EmailToken is a single-use token delivered by email. Only the SHA-256 hash
+// of the token is stored.
+type EmailToken struct {
+	gorm.Model
+	UserID    uint       `gorm:"index" json:"user_id"`
+	Purpose   string     `gorm:"index" json:"purpose"`
+	TokenHash string     `gorm:"uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	SessionID *uint      `json:"-"`
+	User      User       `gorm:"foreignKey:UserID" json:"-"`
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Identity links a user to an account at an external login provider. The
+// provider's subject identifier, not the email address, is what identifies
+// the account on later logins.
+type Identity struct {
+	gorm.Model
+	UserID        uint       `gorm:"index" json:"-"`
+	Provider      string     `gorm:"uniqueIndex:idx_identity_provider_subject" json:"provider"`
+	Subject       string     `gorm:"uniqueIndex:idx_identity_provider_subject" json:"-"`
+	Email         string     `json:"email"`
+	EmailVerified bool       `json:"email_verified"`
+	Name          string     `json:"name"`
+	ImageURL      string     `json:"image_url"`
+	LastLoginAt   *time.Time `json:"last_login_at"`
+	User          User       `gorm:"foreignKey:UserID" json:"-"`
+}
+
+// migrateLegacyIdentities moves the Google account IDs that used to live on
+// the users table into identities and drops the old columns.
+func migrateLegacyIdentities(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&User{}, "google_id") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`
+			INSERT INTO identities (created_at, updated_at, user_id, provider, subject, email, email_verified, name, image_url)
+			SELECT NOW(), NOW(), id, 'google', google_id, email, is_verified, name, image_url
+			FROM users
+			WHERE google_id IS NOT NULL AND google_id <> '' AND deleted_at IS NULL
+			ON CONFLICT DO NOTHING`).Error; err != nil {
+			return err
+		}
+
+		for _, column := range []string{"google_id", "provider"} {
+			if err := tx.Migrator().DropColumn(&User{}, column); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// PendingLink is an external identity whose email matches an existing
+// account that could not be linked automatically. It is linked once the
+// account owner confirms with their password or with a link sent to the
+// account's email address. Links a signed-in user started with
+// StartIdentityLink have SignedIn set and can only be completed by that
+// user's session.
+type PendingLink struct {
+	gorm.Model
+	UserID           uint       `gorm:"index" json:"-"`
+	Provider         string     `json:"provider"`
+	Subject          string     `json:"-"`
+	Email            string     `json:"email"`
+	EmailVerified    bool       `json:"email_verified"`
+	Name             string     `json:"name"`
+	ImageURL         string     `json:"image_url"`
+	TokenHash        string     `gorm:"uniqueIndex" json:"-"`
+	ConfirmationHash *string    `gorm:"uniqueIndex" json:"-"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+	UsedAt           *time.Time `json:"used_at"`
+	SignedIn         bool       `gorm:"not null;default:false" json:"-"`
+	User             User       `gorm:"foreignKey:UserID" json:"-"`
+}
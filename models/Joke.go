@@ -0,0 +1,19 @@
+package models
+
+import "gorm.io/gorm"
+
+// Joke is one joke generated for a prompt. Provider, Model, token usage and
+// latency describe the model call the joke came from, which produced every
+// joke of that language for the prompt.
+type Joke struct {
+	gorm.Model
+	PromptID     uint   `gorm:"index" json:"prompt_id"`
+	Language     string `json:"language"`
+	Position     int    `json:"position"`
+	Text         string `json:"text"`
+	Provider     string `json:"provider"`
+	ModelName    string `gorm:"column:model" json:"model"`
+	InputTokens  int    `json:"input_tokens"`
+	OutputTokens int    `json:"output_tokens"`
+	LatencyMS    int64  `json:"latency_ms"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// KnownDevice is a user-agent and IP address combination a user has logged
+// in from before. Logins from anywhere else trigger a new-device email.
+type KnownDevice struct {
+	gorm.Model
+	UserID      uint      `gorm:"uniqueIndex:idx_known_device_user_fingerprint" json:"-"`
+	Fingerprint string    `gorm:"uniqueIndex:idx_known_device_user_fingerprint" json:"-"`
+	Device      string    `json:"device"`
+	IPAddress   string    `json:"ip_address"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+	User        User      `gorm:"foreignKey:UserID" json:"-"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// LoginThrottle counts consecutive failed logins for one key, either an
+// account ("account:<email>") or a client IP ("ip:<address>").
+type LoginThrottle struct {
+	ID            uint `gorm:"primaryKey"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Key           string `gorm:"uniqueIndex"`
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+}
@@ -7,4 +7,5 @@ type Prompt struct {
 	UserID uint   `json:"user_id"`
 	Text   string `json:"text"`
 	User   User   `gorm:"foreignKey:UserID"`
+	Jokes  []Joke `json:"jokes"`
 }
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// RateLimitBucket stores token bucket state so limits are shared between
+// instances.
+type RateLimitBucket struct {
+	Key       string `gorm:"primaryKey"`
+	Tokens    float64
+	UpdatedAt time.Time `gorm:"index"`
+}
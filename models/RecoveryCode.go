@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RecoveryCode is a one-time 2FA backup code. Only its hash is stored.
+type RecoveryCode struct {
+	gorm.Model
+	UserID   uint       `gorm:"index" json:"user_id"`
+	CodeHash string     `gorm:"index" json:"-"`
+	UsedAt   *time.Time `json:"used_at"`
+}
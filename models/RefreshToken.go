@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RefreshToken is an opaque, single-use token that can be exchanged for a new
+// access token. Only the SHA-256 hash of the token is stored. Every token
+// minted from the same login shares a FamilyID so that reuse of a rotated
+// token can revoke the whole chain.
+type RefreshToken struct {
+	gorm.Model
+	UserID       uint       `gorm:"index" json:"user_id"`
+	FamilyID     string     `gorm:"index" json:"family_id"`
+	TokenHash    string     `gorm:"uniqueIndex" json:"-"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+	ReplacedByID *uint      `json:"replaced_by_id"`
+	User         User       `gorm:"foreignKey:UserID" json:"-"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// RevokedToken records the jti of an access token that was revoked before it
+// expired. Rows can be pruned once ExpiresAt has passed.
+type RevokedToken struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	JTI       string    `gorm:"uniqueIndex;column:jti"`
+	UserID    uint      `gorm:"index"`
+	ExpiresAt time.Time `gorm:"index"`
+}
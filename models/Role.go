@@ -0,0 +1,115 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Built-in roles
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Permissions checked by middlewares.RequirePermission
+const (
+	PermissionUsersRead    = "users:read"
+	PermissionUsersSuspend = "users:suspend"
+	PermissionUsersVerify  = "users:verify"
+	PermissionUsersUnlock  = "users:unlock"
+	PermissionUsersDelete  = "users:delete"
+	PermissionUsersRoles   = "users:roles"
+)
+
+// defaultRolePermissions is what SeedRoles grants each built-in role
+var defaultRolePermissions = map[string][]string{
+	RoleUser:      {},
+	RoleModerator: {PermissionUsersRead, PermissionUsersSuspend, PermissionUsersVerify, PermissionUsersUnlock},
+	RoleAdmin: {
+		PermissionUsersRead, PermissionUsersSuspend, PermissionUsersVerify,
+		PermissionUsersUnlock, PermissionUsersDelete, PermissionUsersRoles,
+	},
+}
+
+// roleRanks orders the built-in roles by seniority. Roles added by hand rank
+// with "user".
+var roleRanks = map[string]int{
+	RoleUser:      0,
+	RoleModerator: 1,
+	RoleAdmin:     2,
+}
+
+// RoleRank returns how senior a role is. Admin actions only apply to users
+// whose role ranks below the caller's.
+func RoleRank(name string) int {
+	return roleRanks[name]
+}
+
+type Role struct {
+	gorm.Model
+	Name        string       `gorm:"uniqueIndex" json:"name"`
+	Permissions []Permission `gorm:"many2many:role_permissions" json:"permissions,omitempty"`
+}
+
+type Permission struct {
+	gorm.Model
+	Name string `gorm:"uniqueIndex" json:"name"`
+}
+
+// PermissionNames returns the names of the role's permissions
+func (r Role) PermissionNames() []string {
+	names := make([]string, 0, len(r.Permissions))
+	for _, permission := range r.Permissions {
+		names = append(names, permission.Name)
+	}
+	return names
+}
+
+// SeedRoles creates the built-in roles and their permissions and gives users
+// without a role the "user" role. Permissions added by hand are kept.
+func SeedRoles(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for roleName, permissionNames := range defaultRolePermissions {
+			role := Role{Name: roleName}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&role).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("name = ?", roleName).First(&role).Error; err != nil {
+				return err
+			}
+
+			for _, permissionName := range permissionNames {
+				permission := Permission{Name: permissionName}
+				if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&permission).Error; err != nil {
+					return err
+				}
+				if err := tx.Where("name = ?", permissionName).First(&permission).Error; err != nil {
+					return err
+				}
+				if err := tx.Model(&role).Association("Permissions").Append(&permission); err != nil {
+					return err
+				}
+			}
+		}
+
+		var userRole Role
+		if err := tx.Where("name = ?", RoleUser).First(&userRole).Error; err != nil {
+			return err
+		}
+		return tx.Model(&User{}).Where("role_id IS NULL OR role_id = 0").Update("role_id", userRole.ID).Error
+	})
+}
+
+// PromoteAdmins gives the admin role to the users with the given emails
+func PromoteAdmins(db *gorm.DB, emails []string) error {
+	if len(emails) == 0 {
+		return nil
+	}
+
+	var adminRole Role
+	if err := db.Where("name = ?", RoleAdmin).First(&adminRole).Error; err != nil {
+		return err
+	}
+	return db.Model(&User{}).Where("email IN ?", emails).Update("role_id", adminRole.ID).Error
+}
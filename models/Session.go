@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Authentication methods recorded on sessions. Logins through an external
+// provider record the provider's name instead, e.g. "google".
+const (
+	AuthMethodPassword  = "password"
+	AuthMethodMagicLink = "magic_link"
+	AuthMethodPasskey   = "passkey"
+)
+
+// Session is one login on one device. It owns a refresh token family and
+// every access token minted from it carries its ID in the sid claim, so
+// revoking the session signs that device out.
+type Session struct {
+	gorm.Model
+	UserID     uint       `gorm:"index" json:"-"`
+	FamilyID   string     `gorm:"uniqueIndex" json:"-"`
+	AuthMethod string     `json:"auth_method"`
+	UserAgent  string     `json:"user_agent"`
+	Device     string     `json:"device"`
+	IPAddress  string     `json:"ip_address"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	User       User       `gorm:"foreignKey:UserID" json:"-"`
+}
@@ -1,18 +1,57 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
 type User struct {
 	gorm.Model
-	Name              string   `json:"name"`
-	Email             string   `gorm:"uniqueIndex" json:"email"`
-	Password          string   `json:"-"`
-	IsVerified        bool     `json:"is_verified" gorm:"default:false"`
-	VerificationToken string   `json:"verification_token"`
-	Provider          string   `json:"provider"`
-	GoogleID          string   `json:"google_id" gorm:"uniqueIndex;null"`
-	ImageURL          string   `json:"image_url"`
-	Prompts           []Prompt `json:"prompts"`
+	Name            string     `json:"name"`
+	Email           string     `gorm:"uniqueIndex:idx_users_email_active,where:deleted_at IS NULL" json:"email"`
+	Password        string     `json:"-"`
+	IsVerified      bool       `json:"is_verified" gorm:"default:false"`
+	ImageURL        string     `json:"image_url"`
+	Prompts         []Prompt   `json:"prompts"`
+	Identities      []Identity `json:"identities,omitempty"`
+	TokensRevokedAt *time.Time `json:"-"`
+	TOTPSecret      string     `json:"-"`
+	TOTPEnabled     bool       `json:"totp_enabled" gorm:"default:false"`
+	TOTPLastStep    int64      `json:"-"`
+	WebAuthnHandle  []byte     `json:"-" gorm:"uniqueIndex"`
+	RoleID          uint       `json:"role_id"`
+	Role            Role       `json:"role"`
+	SuspendedAt     *time.Time `json:"suspended_at"`
+	NotifyNewDevice bool       `json:"notify_new_device" gorm:"default:true"`
+}
+
+// BeforeCreate gives new users the default role
+func (u *User) BeforeCreate(tx *gorm.DB) error {
+	if u.RoleID != 0 {
+		return nil
+	}
+
+	var role Role
+	if err := tx.Where("name = ?", RoleUser).First(&role).Error; err != nil {
+		return err
+	}
+	u.RoleID = role.ID
+	return nil
+}
+
+// migrateLegacyUserColumns drops columns and indexes that are no longer used.
+// Email verification tokens now live in the email_tokens table, and emails
+// are only unique among users that have not been deleted, so a deleted
+// user's address can sign up again.
+func migrateLegacyUserColumns(db *gorm.DB) error {
+	if db.Migrator().HasColumn(&User{}, "verification_token") {
+		if err := db.Migrator().DropColumn(&User{}, "verification_token"); err != nil {
+			return err
+		}
+	}
+	if db.Migrator().HasIndex(&User{}, "idx_users_email") {
+		return db.Migrator().DropIndex(&User{}, "idx_users_email")
+	}
+	return nil
 }
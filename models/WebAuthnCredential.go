@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WebAuthnCredential is a passkey registered by a user
+type WebAuthnCredential struct {
+	gorm.Model
+	UserID          uint       `gorm:"index" json:"user_id"`
+	Name            string     `json:"name"`
+	CredentialID    []byte     `gorm:"uniqueIndex" json:"credential_id"`
+	PublicKey       []byte     `json:"-"`
+	AttestationType string     `json:"attestation_type"`
+	AAGUID          []byte     `gorm:"column:aaguid" json:"aaguid"`
+	SignCount       uint32     `json:"sign_count"`
+	Transports      string     `json:"transports"`
+	UserVerified    bool       `json:"user_verified"`
+	BackupEligible  bool       `json:"backup_eligible"`
+	BackupState     bool       `json:"backup_state"`
+	CloneWarning    bool       `json:"clone_warning"`
+	LastUsedAt      *time.Time `json:"last_used_at"`
+	User            User       `gorm:"foreignKey:UserID" json:"-"`
+}
+
+// WebAuthnSession holds the challenge of an in-flight registration or
+// assertion ceremony between its begin and finish requests.
+type WebAuthnSession struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	TokenHash string `gorm:"uniqueIndex"`
+	UserID    uint   `gorm:"index"`
+	Ceremony  string
+	Data      []byte
+	ExpiresAt time.Time `gorm:"index"`
+}
@@ -27,7 +27,7 @@ func InitDB(cfg Config) {
 		panic(err)
 	}
 
-	if err := db.AutoMigrate(&User{}, &Prompt{}, &AnonymousGeneration{}); err != nil {
+	if err := Migrate(db); err != nil {
 		panic(err)
 	}
 
@@ -36,6 +36,23 @@ func InitDB(cfg Config) {
 	DB = db
 }
 
+// Migrate brings the schema up to date and seeds the built-in roles
+func Migrate(db *gorm.DB) error {
+	if err := db.AutoMigrate(&Role{}, &Permission{}, &User{}, &Prompt{}, &Joke{}, &AnonymousGeneration{}, &RefreshToken{}, &RevokedToken{}, &EmailToken{}, &RecoveryCode{}, &WebAuthnCredential{}, &WebAuthnSession{}, &LoginThrottle{}, &RateLimitBucket{}, &APIKey{}, &Identity{}, &PendingLink{}, &AuthCode{}, &Session{}, &KnownDevice{}); err != nil {
+		return err
+	}
+
+	if err := migrateLegacyIdentities(db); err != nil {
+		return err
+	}
+
+	if err := migrateLegacyUserColumns(db); err != nil {
+		return err
+	}
+
+	return SeedRoles(db)
+}
+
 func GetDB() *gorm.DB {
 	return DB
 }
@@ -3,22 +3,100 @@ package routes
 import (
 	"go-auth-app/controllers"
 	"go-auth-app/middlewares"
+	"go-auth-app/models"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// Rate limit policies. Routes using the same policy share its buckets.
+// jokesIPLimit caps each client IP as well, since anonymous IDs are chosen by
+// the client.
+var (
+	defaultLimit   = middlewares.RateLimitPolicy{Name: "default", Limit: 300, Period: time.Minute, Key: middlewares.KeyByIP}
+	loginLimit     = middlewares.RateLimitPolicy{Name: "login", Limit: 10, Period: time.Minute, Key: middlewares.KeyByIP}
+	signupLimit    = middlewares.RateLimitPolicy{Name: "signup", Limit: 5, Period: time.Hour, Key: middlewares.KeyByIP}
+	emailLinkLimit = middlewares.RateLimitPolicy{Name: "email-link", Limit: 5, Period: 15 * time.Minute, Key: middlewares.KeyByIP}
+	tokenLimit     = middlewares.RateLimitPolicy{Name: "token", Limit: 30, Period: time.Minute, Key: middlewares.KeyByIP}
+	jokesLimit     = middlewares.RateLimitPolicy{Name: "jokes", Limit: 10, Period: time.Minute, Key: middlewares.KeyByAnonymousID}
+	jokesIPLimit   = middlewares.RateLimitPolicy{Name: "jokes-ip", Limit: 30, Period: time.Minute, Key: middlewares.KeyByIP}
+)
+
 func AuthRoutes(r *gin.Engine) {
+	r.Use(middlewares.RateLimit(defaultLimit))
+
 	r.GET("/home", controllers.Home)
-	r.POST("/login", controllers.Login)
-	r.POST("/signup", controllers.Signup)
-	r.GET("/logout", controllers.Logout)
+	r.POST("/login", middlewares.RateLimit(loginLimit), controllers.Login)
+	r.POST("/login/2fa", middlewares.RateLimit(loginLimit), controllers.LoginTwoFactor)
+	r.POST("/login/magic-link", middlewares.RateLimit(emailLinkLimit), controllers.RequestMagicLink)
+	r.POST("/login/magic-link/verify", middlewares.RateLimit(loginLimit), controllers.MagicLinkLogin)
+	r.POST("/signup", middlewares.RateLimit(signupLimit), controllers.Signup)
+	r.POST("/logout", middlewares.IsAuthorized(false), controllers.Logout)
+	r.POST("/logout-all", middlewares.IsAuthorized(false), controllers.LogoutAll)
 	r.GET("/verify", controllers.VerifyEmail)
+	r.POST("/token/refresh", middlewares.RateLimit(tokenLimit), controllers.RefreshToken)
+	r.GET("/.well-known/jwks.json", controllers.JWKS)
+
+	// External login providers
+	r.GET("/auth/providers", controllers.ListOAuthProviders)
+	r.GET("/auth/csrf", middlewares.IsAuthorized(false), controllers.CSRFToken)
+	r.GET("/auth/:provider", controllers.OAuthLogin)
+	r.GET("/auth/:provider/callback", controllers.OAuthCallback)
+	r.POST("/auth/exchange", middlewares.RateLimit(tokenLimit), controllers.ExchangeAuthCode)
+
+	// Linked login methods
+	r.GET("/identities", middlewares.IsAuthorized(false), controllers.ListIdentities)
+	r.POST("/identities/:provider/link", middlewares.IsAuthorized(false), controllers.StartIdentityLink)
+	r.POST("/identities/link/complete", middlewares.IsAuthorized(false), controllers.CompleteIdentityLink)
+	r.DELETE("/identities/:id", middlewares.IsAuthorized(false), controllers.UnlinkIdentity)
+	r.POST("/identities/link/password", middlewares.RateLimit(loginLimit), controllers.ConfirmLinkWithPassword)
+	r.POST("/identities/link/email", middlewares.RateLimit(emailLinkLimit), controllers.SendLinkConfirmation)
+	r.POST("/identities/link/verify", middlewares.RateLimit(loginLimit), controllers.ConfirmLinkByEmail)
+
+	r.GET("/profile", middlewares.AllowAPIKey(models.ScopeProfileRead), middlewares.IsAuthorized(false), controllers.Profile)
+	r.GET("/prompts/:id", middlewares.AllowAPIKey(models.ScopeProfileRead), middlewares.IsAuthorized(false), controllers.GetPrompt)
+
+	// Signed-in devices
+	r.GET("/sessions", middlewares.IsAuthorized(false), controllers.ListSessions)
+	r.DELETE("/sessions/:id", middlewares.IsAuthorized(false), controllers.RevokeSession)
+	r.POST("/sessions/report", middlewares.RateLimit(loginLimit), controllers.ReportSession)
+	r.GET("/preferences", middlewares.IsAuthorized(false), controllers.GetPreferences)
+	r.PATCH("/preferences", middlewares.IsAuthorized(false), controllers.UpdatePreferences)
+
+	// API keys
+	r.GET("/api-keys", middlewares.IsAuthorized(false), controllers.ListAPIKeys)
+	r.POST("/api-keys", middlewares.IsAuthorized(false), controllers.CreateAPIKey)
+	r.DELETE("/api-keys/:id", middlewares.IsAuthorized(false), controllers.RevokeAPIKey)
+
+	// Two-factor authentication
+	r.POST("/2fa/enroll", middlewares.IsAuthorized(false), controllers.EnrollTOTP)
+	r.POST("/2fa/confirm", middlewares.IsAuthorized(false), controllers.ConfirmTOTP)
+	r.POST("/2fa/disable", middlewares.IsAuthorized(false), controllers.DisableTOTP)
+
+	// Passkeys
+	r.POST("/webauthn/register/begin", middlewares.IsAuthorized(false), controllers.BeginPasskeyRegistration)
+	r.POST("/webauthn/register/finish", middlewares.IsAuthorized(false), controllers.FinishPasskeyRegistration)
+	r.POST("/webauthn/login/begin", middlewares.RateLimit(loginLimit), controllers.BeginPasskeyLogin)
+	r.POST("/webauthn/login/finish", middlewares.RateLimit(loginLimit), controllers.FinishPasskeyLogin)
+	r.GET("/webauthn/credentials", middlewares.IsAuthorized(false), controllers.ListPasskeys)
+	r.DELETE("/webauthn/credentials/:id", middlewares.IsAuthorized(false), controllers.DeletePasskey)
 
-	// Google OAuth Routes
-	r.GET("/auth/google", controllers.GoogleLogin)
-	r.GET("/auth/google/callback", controllers.GoogleAuthCallback)
+	// Admin
+	admin := r.Group("/admin", middlewares.IsAuthorized(false))
+	{
+		admin.GET("/users", middlewares.RequirePermission(models.PermissionUsersRead), controllers.ListUsers)
+		admin.POST("/users/:id/suspend", middlewares.RequirePermission(models.PermissionUsersSuspend), controllers.SuspendUser)
+		admin.POST("/users/:id/unsuspend", middlewares.RequirePermission(models.PermissionUsersSuspend), controllers.UnsuspendUser)
+		admin.POST("/users/:id/verify", middlewares.RequirePermission(models.PermissionUsersVerify), controllers.VerifyUser)
+		admin.POST("/users/:id/unlock", middlewares.RequirePermission(models.PermissionUsersUnlock), controllers.UnlockUser)
+		admin.PUT("/users/:id/role", middlewares.RequirePermission(models.PermissionUsersRoles), controllers.SetUserRole)
+		admin.DELETE("/users/:id", middlewares.RequirePermission(models.PermissionUsersDelete), controllers.DeleteUser)
+	}
 
-	r.GET("/profile", middlewares.IsAuthorized(false), controllers.Profile)
-	r.POST("/reset-password", controllers.ResetPassword)
-	r.POST("/generate-jokes", middlewares.IsAuthorized(true), controllers.GenerateJokes)
+	r.POST("/password/forgot", middlewares.RateLimit(emailLinkLimit), controllers.ForgotPassword)
+	r.POST("/password/reset", middlewares.RateLimit(loginLimit), controllers.ResetPassword)
+	r.GET("/generate-jokes/languages", controllers.ListJokeLanguages)
+	r.POST("/generate-jokes", middlewares.AllowAPIKey(models.ScopeJokesGenerate), middlewares.IsAuthorized(true), middlewares.RateLimit(jokesLimit), middlewares.RateLimit(jokesIPLimit), controllers.GenerateJokes)
+	r.GET("/generate-jokes/stream", middlewares.AllowAPIKey(models.ScopeJokesGenerate), middlewares.RequireCSRF(), middlewares.IsAuthorized(true), middlewares.RateLimit(jokesLimit), middlewares.RateLimit(jokesIPLimit), controllers.GenerateJokesStream)
+	r.POST("/generate-jokes/stream", middlewares.AllowAPIKey(models.ScopeJokesGenerate), middlewares.IsAuthorized(true), middlewares.RateLimit(jokesLimit), middlewares.RateLimit(jokesIPLimit), controllers.GenerateJokesStream)
 }
@@ -0,0 +1,221 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-auth-app/controllers"
+	"go-auth-app/jokegen"
+	"go-auth-app/models"
+	"go-auth-app/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// setupRouter serves AuthRoutes from a fresh SQLite database with jokes
+// from the fake generator.
+func setupRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	if err := models.Migrate(db); err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+
+	previous := models.DB
+	models.DB = db
+	utils.ResetRevocationCache()
+	controllers.SetJokeGenerator(jokegen.NewFake())
+	t.Cleanup(func() {
+		models.DB = previous
+		controllers.SetJokeGenerator(nil)
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("db", db)
+		c.Next()
+	})
+	AuthRoutes(r)
+	return r
+}
+
+// streamRecorder is a ResponseRecorder gin can stream to, which needs a
+// CloseNotifier
+type streamRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (streamRecorder) CloseNotify() <-chan bool {
+	return make(chan bool)
+}
+
+func serve(r *gin.Engine, req *http.Request) *httptest.ResponseRecorder {
+	w := streamRecorder{httptest.NewRecorder()}
+	r.ServeHTTP(w, req)
+	return w.ResponseRecorder
+}
+
+// signIn returns an access token for a new verified user
+func signIn(t *testing.T, email string) string {
+	t.Helper()
+
+	var role models.Role
+	if err := models.DB.Where("name = ?", models.RoleUser).First(&role).Error; err != nil {
+		t.Fatalf("find role: %v", err)
+	}
+	user := models.User{Name: email, Email: email, IsVerified: true, RoleID: role.ID}
+	if err := models.DB.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	session, err := utils.StartSession(user.ID, models.AuthMethodPassword, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("start session: %v", err)
+	}
+	token, err := utils.GenerateJWT(user, session.ID)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	return token
+}
+
+func TestJokeStreamMethods(t *testing.T) {
+	r := setupRouter(t)
+	token := signIn(t, "stream@example.com")
+
+	tests := []struct {
+		name string
+		req  *http.Request
+	}{
+		{"POST", httptest.NewRequest(http.MethodPost, "/generate-jokes/stream", strings.NewReader(`{"prompt":"cats","languages":["en","hi"]}`))},
+		{"GET", httptest.NewRequest(http.MethodGet, "/generate-jokes/stream?prompt=cats&languages=en,hi", nil)},
+	}
+	for _, tt := range tests {
+		tt.req.Header.Set("Content-Type", "application/json")
+		tt.req.Header.Set("Authorization", "Bearer "+token)
+		w := serve(r, tt.req)
+
+		body := w.Body.String()
+		if w.Code != 200 {
+			t.Fatalf("%s: status %d %s", tt.name, w.Code, body)
+		}
+		for _, want := range []string{"event:languages", `"language":"en"`, `"language":"hi"`, "event:done"} {
+			if !strings.Contains(body, want) {
+				t.Errorf("%s: stream is missing %s:\n%s", tt.name, want, body)
+			}
+		}
+	}
+}
+
+func TestJokeStreamChecksCSRFInCookieMode(t *testing.T) {
+	t.Setenv("SESSION_MODE", utils.SessionModeCookie)
+	r := setupRouter(t)
+	token := signIn(t, "cookie@example.com")
+
+	stream := func(method, query, header string) int {
+		var body *bytes.Reader
+		if method == http.MethodPost {
+			body = bytes.NewReader([]byte(`{"prompt":"cats"}`))
+		} else {
+			body = bytes.NewReader(nil)
+		}
+		req := httptest.NewRequest(method, "/generate-jokes/stream?prompt=cats"+query, body)
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{Name: utils.AccessTokenCookie, Value: token})
+		req.AddCookie(&http.Cookie{Name: utils.CSRFCookie, Value: "csrf-secret"})
+		if header != "" {
+			req.Header.Set(utils.CSRFHeader, header)
+		}
+		return serve(r, req).Code
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		query  string
+		header string
+		want   int
+	}{
+		{"GET without a token", http.MethodGet, "", "", 403},
+		{"GET with a wrong token", http.MethodGet, "&csrf_token=guess", "", 403},
+		{"GET with the token in the query", http.MethodGet, "&csrf_token=csrf-secret", "", 200},
+		{"GET with the token in the header", http.MethodGet, "", "csrf-secret", 200},
+		{"POST without a token", http.MethodPost, "", "", 403},
+		{"POST with the token in the query", http.MethodPost, "&csrf_token=csrf-secret", "", 403},
+		{"POST with the token in the header", http.MethodPost, "", "csrf-secret", 200},
+	}
+	for _, tt := range tests {
+		if got := stream(tt.method, tt.query, tt.header); got != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCSRFTokenEndpoint(t *testing.T) {
+	t.Setenv("SESSION_MODE", utils.SessionModeCookie)
+	r := setupRouter(t)
+	token := signIn(t, "csrf@example.com")
+
+	if w := serve(r, httptest.NewRequest(http.MethodGet, "/auth/csrf", nil)); w.Code != 401 {
+		t.Fatalf("without a session: %d, want 401", w.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/csrf", nil)
+	req.AddCookie(&http.Cookie{Name: utils.AccessTokenCookie, Value: token})
+	w := serve(r, req)
+	if w.Code != 200 {
+		t.Fatalf("with a session: %d %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		CSRFToken string `json:"csrf_token"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+
+	var cookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == utils.CSRFCookie {
+			cookie = c
+		}
+	}
+	if response.CSRFToken == "" || cookie == nil || cookie.Value != response.CSRFToken || cookie.HttpOnly {
+		t.Fatalf("token %q, cookie %+v; want a readable cookie holding the returned token", response.CSRFToken, cookie)
+	}
+
+	// The new token passes the double-submit check
+	req = httptest.NewRequest(http.MethodPost, "/generate-jokes/stream", strings.NewReader(`{"prompt":"cats"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(utils.CSRFHeader, response.CSRFToken)
+	req.AddCookie(&http.Cookie{Name: utils.AccessTokenCookie, Value: token})
+	req.AddCookie(cookie)
+	if w := serve(r, req); w.Code != 200 {
+		t.Fatalf("request with the new token: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestCSRFTokenEndpointNeedsCookieSessions(t *testing.T) {
+	r := setupRouter(t)
+	token := signIn(t, "bearer@example.com")
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/csrf", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if w := serve(r, req); w.Code != 404 {
+		t.Fatalf("in bearer mode: %d %s, want 404", w.Code, w.Body.String())
+	}
+}
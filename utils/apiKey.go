@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"go-auth-app/models"
+	"strings"
+	"time"
+)
+
+// APIKeyPrefix marks a bearer credential as an API key rather than a JWT
+const APIKeyPrefix = "jm_"
+
+// lastUsedResolution limits how often last_used_at is written for busy keys
+const lastUsedResolution = time.Minute
+
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// IsAPIKey reports whether a bearer credential looks like an API key
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// GenerateAPIKey returns a new key of the form jm_<prefix>_<secret> along
+// with its prefix and the hash that should be persisted.
+func GenerateAPIKey() (string, string, string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	prefix := hex.EncodeToString(b)
+
+	secret, _, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", "", "", err
+	}
+
+	key := APIKeyPrefix + prefix + "_" + secret
+	return key, prefix, HashToken(key), nil
+}
+
+// AuthenticateAPIKey looks up an active key and the user it belongs to and
+// records that it was used.
+func AuthenticateAPIKey(key string) (*models.APIKey, error) {
+	var apiKey models.APIKey
+	if err := models.DB.Preload("User").Where("key_hash = ?", HashToken(key)).First(&apiKey).Error; err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	now := time.Now()
+	if apiKey.RevokedAt != nil || (apiKey.ExpiresAt != nil && now.After(*apiKey.ExpiresAt)) {
+		return nil, ErrInvalidAPIKey
+	}
+	// The user may have been deleted or suspended since the key was created
+	if apiKey.User.ID == 0 || apiKey.User.SuspendedAt != nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= lastUsedResolution {
+		if err := models.DB.Model(&apiKey).UpdateColumn("last_used_at", now).Error; err != nil {
+			return nil, err
+		}
+		apiKey.LastUsedAt = &now
+	}
+
+	return &apiKey, nil
+}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"errors"
+	"go-auth-app/models"
+	"time"
+)
+
+// AuthCodeTTL is how long the frontend has to exchange a login code
+const AuthCodeTTL = time.Minute
+
+// IdentityLinkTTL is how long a signed-in user has to start the provider
+// login that links a new identity to their account.
+const IdentityLinkTTL = 2 * time.Minute
+
+var ErrInvalidAuthCode = errors.New("invalid or expired code")
+
+// CreateAuthCode stores a new single-use code for the user and returns the
+// plaintext value to put in a URL. authMethod records how the user logged in
+// for the session the code is exchanged for.
+func CreateAuthCode(userID uint, purpose, authMethod string, ttl time.Duration) (string, error) {
+	code, hash, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	authCode := models.AuthCode{
+		UserID:     userID,
+		Purpose:    purpose,
+		AuthMethod: authMethod,
+		CodeHash:   hash,
+		ExpiresAt:  time.Now().Add(ttl),
+	}
+	if err := models.DB.Create(&authCode).Error; err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// ConsumeAuthCode marks a code as used and returns it. A code can only be
+// consumed once, even by concurrent requests.
+func ConsumeAuthCode(code string, purpose string) (*models.AuthCode, error) {
+	var authCode models.AuthCode
+	if err := models.DB.Where("code_hash = ? AND purpose = ?", HashToken(code), purpose).First(&authCode).Error; err != nil {
+		return nil, ErrInvalidAuthCode
+	}
+
+	now := time.Now()
+	result := models.DB.Model(&models.AuthCode{}).
+		Where("id = ? AND used_at IS NULL AND expires_at > ?", authCode.ID, now).
+		Update("used_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidAuthCode
+	}
+
+	authCode.UsedAt = &now
+	return &authCode, nil
+}
+
+// PruneAuthCodes deletes codes that can no longer be exchanged
+func PruneAuthCodes() error {
+	return models.DB.Unscoped().Where("expires_at < ?", time.Now()).Delete(&models.AuthCode{}).Error
+}
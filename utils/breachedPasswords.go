@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
+)
+
+// breachedFalsePositiveRate is the chance that a password missing from the
+// corpus is still reported as breached. It decides the size of the filter.
+const breachedFalsePositiveRate = 0.001
+
+// bloomFilter is a fixed-size set that can answer "definitely not present"
+// or "probably present". It keeps a corpus of millions of passwords in a few
+// megabytes of memory.
+type bloomFilter struct {
+	bits   []uint64
+	size   uint64
+	hashes uint64
+}
+
+func newBloomFilter(entries int, falsePositiveRate float64) *bloomFilter {
+	if entries < 1 {
+		entries = 1
+	}
+	size := uint64(math.Ceil(-float64(entries) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	hashes := uint64(math.Max(1, math.Round(float64(size)/float64(entries)*math.Ln2)))
+	return &bloomFilter{bits: make([]uint64, (size+63)/64), size: size, hashes: hashes}
+}
+
+// positions derives the filter positions of a SHA-1 digest by double hashing
+func (f *bloomFilter) positions(digest [sha1.Size]byte, visit func(uint64)) {
+	h1 := binary.BigEndian.Uint64(digest[0:8])
+	h2 := binary.BigEndian.Uint64(digest[8:16]) | 1
+	for i := uint64(0); i < f.hashes; i++ {
+		visit((h1 + i*h2) % f.size)
+	}
+}
+
+func (f *bloomFilter) add(digest [sha1.Size]byte) {
+	f.positions(digest, func(bit uint64) {
+		f.bits[bit/64] |= 1 << (bit % 64)
+	})
+}
+
+func (f *bloomFilter) contains(digest [sha1.Size]byte) bool {
+	found := true
+	f.positions(digest, func(bit uint64) {
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			found = false
+		}
+	})
+	return found
+}
+
+var (
+	breachedMu     sync.RWMutex
+	breachedFilter *bloomFilter
+)
+
+// LoadBreachedPasswords builds the breached password filter from a corpus
+// file with one entry per line, optionally gzip compressed. Entries are
+// either plain passwords or SHA-1 hashes in the Have I Been Pwned format
+// ("HASH" or "HASH:COUNT"), so the offline HIBP dump can be used directly.
+func LoadBreachedPasswords(path string) (int, error) {
+	entries := 0
+	if err := readBreachedCorpus(path, func([sha1.Size]byte) { entries++ }); err != nil {
+		return 0, err
+	}
+
+	filter := newBloomFilter(entries, breachedFalsePositiveRate)
+	if err := readBreachedCorpus(path, filter.add); err != nil {
+		return 0, err
+	}
+
+	breachedMu.Lock()
+	breachedFilter = filter
+	breachedMu.Unlock()
+	return entries, nil
+}
+
+// IsBreachedPassword reports whether the password is probably in the loaded
+// corpus. Without a corpus every password passes.
+func IsBreachedPassword(password string) bool {
+	breachedMu.RLock()
+	filter := breachedFilter
+	breachedMu.RUnlock()
+
+	if filter == nil {
+		return false
+	}
+	return filter.contains(sha1.Sum([]byte(password)))
+}
+
+func readBreachedCorpus(path string, visit func([sha1.Size]byte)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var source io.Reader = reader
+	if magic, err := reader.Peek(2); err == nil && bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		source = gz
+	}
+
+	scanner := bufio.NewScanner(source)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		visit(breachedDigest(line))
+	}
+	return scanner.Err()
+}
+
+// breachedDigest returns the SHA-1 digest for a corpus line, decoding it
+// when the line already is a hash
+func breachedDigest(line string) [sha1.Size]byte {
+	var digest [sha1.Size]byte
+
+	candidate := line
+	if colon := strings.IndexByte(line, ':'); colon == 2*sha1.Size {
+		candidate = line[:colon]
+	}
+	if len(candidate) == 2*sha1.Size {
+		if decoded, err := hex.DecodeString(candidate); err == nil {
+			copy(digest[:], decoded)
+			return digest
+		}
+	}
+
+	return sha1.Sum([]byte(line))
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"errors"
+	"go-auth-app/models"
+	"time"
+)
+
+var ErrInvalidEmailToken = errors.New("invalid or expired token")
+
+// CreateEmailToken stores a new single-use token for the user and returns the
+// plaintext value to embed in an email link. Unused tokens of the same
+// purpose are invalidated so only the latest link works.
+func CreateEmailToken(userID uint, purpose string, ttl time.Duration) (string, error) {
+	token, hash, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	if err := models.DB.Model(&models.EmailToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", now).Error; err != nil {
+		return "", err
+	}
+
+	emailToken := models.EmailToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hash,
+		ExpiresAt: now.Add(ttl),
+	}
+	if err := models.DB.Create(&emailToken).Error; err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// FindEmailToken returns a token that is still valid without consuming it
+func FindEmailToken(token string, purpose string) (*models.EmailToken, error) {
+	var emailToken models.EmailToken
+	if err := models.DB.
+		Where("token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", HashToken(token), purpose, time.Now()).
+		First(&emailToken).Error; err != nil {
+		return nil, ErrInvalidEmailToken
+	}
+	return &emailToken, nil
+}
+
+// ConsumeEmailToken marks a token as used and returns it. A token can only be
+// consumed once, even by concurrent requests.
+func ConsumeEmailToken(token string, purpose string) (*models.EmailToken, error) {
+	var emailToken models.EmailToken
+	if err := models.DB.Where("token_hash = ? AND purpose = ?", HashToken(token), purpose).First(&emailToken).Error; err != nil {
+		return nil, ErrInvalidEmailToken
+	}
+
+	now := time.Now()
+	result := models.DB.Model(&models.EmailToken{}).
+		Where("id = ? AND used_at IS NULL AND expires_at > ?", emailToken.ID, now).
+		Update("used_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidEmailToken
+	}
+
+	emailToken.UsedAt = &now
+	return &emailToken, nil
+}
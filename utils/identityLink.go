@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"errors"
+	"go-auth-app/models"
+	"time"
+)
+
+// PendingLinkTTL is how long the owner of an account has to confirm linking
+// an external identity to it.
+const PendingLinkTTL = 15 * time.Minute
+
+var ErrInvalidPendingLink = errors.New("invalid or expired link request")
+
+// CreatePendingLink stores an external identity that is waiting for the
+// owner of the account to confirm it and returns the token the browser uses
+// to refer to it.
+func CreatePendingLink(userID uint, identity *ExternalIdentity) (string, error) {
+	return createPendingLink(userID, identity, false)
+}
+
+// CreateSignedInLink stores an external identity a signed-in user asked to
+// link and returns the token their session completes it with. Until then the
+// provider login cannot be pinned on a user who did not start it.
+func CreateSignedInLink(userID uint, identity *ExternalIdentity) (string, error) {
+	return createPendingLink(userID, identity, true)
+}
+
+func createPendingLink(userID uint, identity *ExternalIdentity, signedIn bool) (string, error) {
+	token, hash, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	link := models.PendingLink{
+		UserID:        userID,
+		Provider:      identity.Provider,
+		Subject:       identity.Subject,
+		Email:         identity.Email,
+		EmailVerified: identity.EmailVerified,
+		Name:          identity.Name,
+		ImageURL:      identity.Picture,
+		TokenHash:     hash,
+		ExpiresAt:     time.Now().Add(PendingLinkTTL),
+		SignedIn:      signedIn,
+	}
+	if err := models.DB.Create(&link).Error; err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// FindPendingLink returns the unused, unexpired pending link for a token
+func FindPendingLink(token string) (*models.PendingLink, error) {
+	var link models.PendingLink
+	if err := models.DB.
+		Where("token_hash = ? AND signed_in = ? AND used_at IS NULL AND expires_at > ?", HashToken(token), false, time.Now()).
+		First(&link).Error; err != nil {
+		return nil, ErrInvalidPendingLink
+	}
+	return &link, nil
+}
+
+// CreatePendingLinkConfirmation returns a token to email to the account owner
+// so they can confirm the link from their inbox.
+func CreatePendingLinkConfirmation(link *models.PendingLink) (string, error) {
+	token, hash, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	if err := models.DB.Model(link).Update("confirmation_hash", hash).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ConsumePendingLink marks a pending link as used, looking it up either by the
+// browser's token or by the emailed confirmation token. A link can only be
+// consumed once, even by concurrent requests.
+func ConsumePendingLink(token string, byConfirmation bool) (*models.PendingLink, error) {
+	column := "token_hash"
+	if byConfirmation {
+		column = "confirmation_hash"
+	}
+
+	var link models.PendingLink
+	if err := models.DB.Where(column+" = ? AND signed_in = ?", HashToken(token), false).First(&link).Error; err != nil {
+		return nil, ErrInvalidPendingLink
+	}
+	return markPendingLinkUsed(&link)
+}
+
+// ConsumeSignedInLink marks a link from CreateSignedInLink as used if it
+// belongs to userID
+func ConsumeSignedInLink(token string, userID uint) (*models.PendingLink, error) {
+	var link models.PendingLink
+	if err := models.DB.Where("token_hash = ? AND signed_in = ? AND user_id = ?", HashToken(token), true, userID).First(&link).Error; err != nil {
+		return nil, ErrInvalidPendingLink
+	}
+	return markPendingLinkUsed(&link)
+}
+
+func markPendingLinkUsed(link *models.PendingLink) (*models.PendingLink, error) {
+	now := time.Now()
+	result := models.DB.Model(&models.PendingLink{}).
+		Where("id = ? AND used_at IS NULL AND expires_at > ?", link.ID, now).
+		Update("used_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidPendingLink
+	}
+
+	link.UsedAt = &now
+	return link, nil
+}
+
+// PendingLinkIdentity returns the identity the pending link is waiting to link
+func PendingLinkIdentity(link *models.PendingLink) *ExternalIdentity {
+	return &ExternalIdentity{
+		Provider:      link.Provider,
+		Subject:       link.Subject,
+		Email:         link.Email,
+		EmailVerified: link.EmailVerified,
+		Name:          link.Name,
+		Picture:       link.ImageURL,
+	}
+}
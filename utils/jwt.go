@@ -3,41 +3,136 @@ package utils
 import (
 	"errors"
 	"go-auth-app/models"
+	"os"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtSecret = []byte("my_secret_key")
+// AccessTokenTTL is the lifetime of access tokens; clients renew them with a
+// refresh token.
+const AccessTokenTTL = 15 * time.Minute
 
-func GenerateJWT(userID uint, email string) (string, error) {
-	expirationTime := time.Now().Add(72 * time.Hour)
+// MFAPendingTTL is how long a user has to enter their second factor
+const MFAPendingTTL = 5 * time.Minute
 
-	claims := &models.Claims{
-		UserID: userID,
-		Email:  email,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(),
-			IssuedAt:  time.Now().Unix(),
-			Issuer:    "go-auth-app",
-		},
+// clockSkewLeeway tolerates small clock differences between this service and
+// the services that verify its tokens.
+const clockSkewLeeway = 30 * time.Second
+
+// jwtIssuer is the iss claim of every token this service issues
+func jwtIssuer() string {
+	if issuer := os.Getenv("JWT_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "go-auth-app"
+}
+
+// jwtAudience is the aud claim of every token this service issues
+func jwtAudience() string {
+	if audience := os.Getenv("JWT_AUDIENCE"); audience != "" {
+		return audience
+	}
+	return "go-auth-app"
+}
+
+var ErrAccountSuspended = errors.New("account is suspended")
+
+// GenerateJWT issues a short-lived access token carrying the user's role and
+// permissions.
+func GenerateJWT(user models.User, sessionID uint) (string, error) {
+	if user.SuspendedAt != nil {
+		return "", ErrAccountSuspended
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	var role models.Role
+	if err := models.DB.Preload("Permissions").First(&role, user.RoleID).Error; err != nil {
+		return "", err
+	}
 
-	tokenString, err := token.SignedString(jwtSecret)
+	return signJWT(&models.Claims{
+		UserID:      user.ID,
+		Email:       user.Email,
+		Purpose:     models.PurposeAccess,
+		Role:        role.Name,
+		Permissions: role.PermissionNames(),
+		SessionID:   sessionID,
+	}, AccessTokenTTL)
+}
+
+// GenerateMFAPendingJWT issues a token proving the first step of a login
+// succeeded. It can only be exchanged at /login/2fa.
+func GenerateMFAPendingJWT(userID uint, email, authMethod string) (string, error) {
+	return signJWT(&models.Claims{
+		UserID:     userID,
+		Email:      email,
+		Purpose:    models.PurposeMFAPending,
+		AuthMethod: authMethod,
+	}, MFAPendingTTL)
+}
+
+// signJWT fills in the registered claims and signs with the active key
+func signJWT(claims *models.Claims, ttl time.Duration) (string, error) {
+	registered, err := newRegisteredClaims(ttl)
 	if err != nil {
 		return "", err
 	}
+	claims.RegisteredClaims = registered
+
+	keys, err := Keys()
+	if err != nil {
+		return "", err
+	}
+
+	return keys.Sign(claims)
+}
+
+// newRegisteredClaims returns the standard claims of a token issued now
+func newRegisteredClaims(ttl time.Duration) (jwt.RegisteredClaims, error) {
+	now := time.Now()
+
+	jti, _, err := GenerateOpaqueToken()
+	if err != nil {
+		return jwt.RegisteredClaims{}, err
+	}
 
-	return tokenString, nil
+	return jwt.RegisteredClaims{
+		ID:        jti,
+		Issuer:    jwtIssuer(),
+		Audience:  jwt.ClaimStrings{jwtAudience()},
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		NotBefore: jwt.NewNumericDate(now),
+		IssuedAt:  jwt.NewNumericDate(now),
+	}, nil
 }
 
+// newJWTParser returns a parser that only accepts tokens this service issued
+func newJWTParser(keys *KeyManager) *jwt.Parser {
+	return jwt.NewParser(
+		jwt.WithValidMethods(keys.Algorithms()),
+		jwt.WithIssuer(jwtIssuer()),
+		jwt.WithAudience(jwtAudience()),
+		jwt.WithLeeway(clockSkewLeeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+}
+
+// ParseJWT parses an access token
 func ParseJWT(tokenStr string) (*models.Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenStr, &models.Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
+	return ParseJWTWithPurpose(tokenStr, models.PurposeAccess)
+}
 
+// ParseJWTWithPurpose verifies a token's signature, algorithm, issuer,
+// audience and validity window, and rejects it unless it was issued for the
+// given purpose.
+func ParseJWTWithPurpose(tokenStr string, purpose string) (*models.Claims, error) {
+	keys, err := Keys()
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := newJWTParser(keys).ParseWithClaims(tokenStr, &models.Claims{}, keys.Keyfunc)
 	if err != nil {
 		return nil, err
 	}
@@ -48,5 +143,17 @@ func ParseJWT(tokenStr string) (*models.Claims, error) {
 		return nil, errors.New("invalid token claims")
 	}
 
+	if claims.Purpose != purpose {
+		return nil, errors.New("invalid token purpose")
+	}
+
+	revoked, err := IsTokenRevoked(claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
+
 	return claims, nil
 }
@@ -0,0 +1,266 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// KeyConfig is one entry of the JWT_KEYS environment variable. HS256 keys
+// need a secret; RS256 and EdDSA keys need a PEM private key to sign, or only
+// a PEM public key if they are kept around to verify older tokens.
+type KeyConfig struct {
+	ID         string `json:"kid"`
+	Algorithm  string `json:"alg"`
+	Secret     string `json:"secret,omitempty"`
+	PrivateKey string `json:"private_key,omitempty"`
+	PublicKey  string `json:"public_key,omitempty"`
+}
+
+// SigningKey is a key that tokens can be verified with and, if it holds
+// private material, signed with.
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// KeyManager holds every key that is currently accepted. New tokens are
+// signed with the active key; the rest only verify tokens issued before a
+// rotation.
+type KeyManager struct {
+	keys   map[string]*SigningKey
+	active *SigningKey
+}
+
+var (
+	keyManagerOnce sync.Once
+	keyManager     *KeyManager
+	keyManagerErr  error
+)
+
+// Keys returns the key manager configured from JWT_KEYS/JWT_SIGNING_KID or,
+// failing that, from JWT_SECRET.
+func Keys() (*KeyManager, error) {
+	keyManagerOnce.Do(func() {
+		keyManager, keyManagerErr = loadKeyManager()
+	})
+	return keyManager, keyManagerErr
+}
+
+func loadKeyManager() (*KeyManager, error) {
+	var configs []KeyConfig
+	if raw := os.Getenv("JWT_KEYS"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &configs); err != nil {
+			return nil, fmt.Errorf("invalid JWT_KEYS: %v", err)
+		}
+	} else if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		configs = []KeyConfig{{ID: "default", Algorithm: "HS256", Secret: secret}}
+	} else {
+		log.Println("JWT_KEYS and JWT_SECRET are not set, using a random key; tokens will not survive a restart")
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		configs = []KeyConfig{{ID: "ephemeral", Algorithm: "HS256", Secret: string(secret)}}
+	}
+
+	return NewKeyManager(configs, os.Getenv("JWT_SIGNING_KID"))
+}
+
+// NewKeyManager builds a key manager from key configs. activeID selects the
+// signing key; when empty the first key that can sign is used.
+func NewKeyManager(configs []KeyConfig, activeID string) (*KeyManager, error) {
+	manager := &KeyManager{keys: make(map[string]*SigningKey)}
+
+	for _, config := range configs {
+		key, err := parseKeyConfig(config)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %v", config.ID, err)
+		}
+		if _, exists := manager.keys[key.ID]; exists {
+			return nil, fmt.Errorf("duplicate key id %q", key.ID)
+		}
+		manager.keys[key.ID] = key
+
+		if manager.active == nil && key.signKey != nil && (activeID == "" || activeID == key.ID) {
+			manager.active = key
+		}
+	}
+
+	if manager.active == nil {
+		return nil, errors.New("no usable signing key configured")
+	}
+	return manager, nil
+}
+
+func parseKeyConfig(config KeyConfig) (*SigningKey, error) {
+	if config.ID == "" {
+		return nil, errors.New("missing kid")
+	}
+
+	key := &SigningKey{ID: config.ID, Algorithm: config.Algorithm}
+
+	switch config.Algorithm {
+	case "HS256":
+		if config.Secret == "" {
+			return nil, errors.New("HS256 keys need a secret")
+		}
+		key.method = jwt.SigningMethodHS256
+		key.signKey = []byte(config.Secret)
+		key.verifyKey = []byte(config.Secret)
+
+	case "RS256":
+		key.method = jwt.SigningMethodRS256
+		if config.PrivateKey != "" {
+			privateKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(config.PrivateKey))
+			if err != nil {
+				return nil, err
+			}
+			key.signKey = privateKey
+			key.verifyKey = &privateKey.PublicKey
+		} else {
+			publicKey, err := jwt.ParseRSAPublicKeyFromPEM([]byte(config.PublicKey))
+			if err != nil {
+				return nil, err
+			}
+			key.verifyKey = publicKey
+		}
+
+	case "EdDSA":
+		key.method = jwt.SigningMethodEdDSA
+		if config.PrivateKey != "" {
+			parsed, err := parsePEM(config.PrivateKey, x509.ParsePKCS8PrivateKey)
+			if err != nil {
+				return nil, err
+			}
+			privateKey, ok := parsed.(ed25519.PrivateKey)
+			if !ok {
+				return nil, errors.New("private key is not an Ed25519 key")
+			}
+			key.signKey = privateKey
+			key.verifyKey = privateKey.Public().(ed25519.PublicKey)
+		} else {
+			parsed, err := parsePEM(config.PublicKey, x509.ParsePKIXPublicKey)
+			if err != nil {
+				return nil, err
+			}
+			publicKey, ok := parsed.(ed25519.PublicKey)
+			if !ok {
+				return nil, errors.New("public key is not an Ed25519 key")
+			}
+			key.verifyKey = publicKey
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", config.Algorithm)
+	}
+
+	return key, nil
+}
+
+func parsePEM(data string, parse func([]byte) (interface{}, error)) (interface{}, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("invalid PEM data")
+	}
+	return parse(block.Bytes)
+}
+
+// Sign signs the claims with the active key and sets the kid header
+func (m *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(m.active.method, claims)
+	token.Header["kid"] = m.active.ID
+	return token.SignedString(m.active.signKey)
+}
+
+// Algorithms lists the signing algorithms of all configured keys
+func (m *KeyManager) Algorithms() []string {
+	seen := make(map[string]bool)
+	var algorithms []string
+	for _, key := range m.keys {
+		if !seen[key.Algorithm] {
+			seen[key.Algorithm] = true
+			algorithms = append(algorithms, key.Algorithm)
+		}
+	}
+	return algorithms
+}
+
+// Keyfunc resolves the verification key for a token from its kid header and
+// refuses tokens whose alg does not match the key's algorithm.
+func (m *KeyManager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token has no kid")
+	}
+
+	key, ok := m.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %q", token.Method.Alg())
+	}
+
+	return key.verifyKey, nil
+}
+
+// JWK is a public key in JSON Web Key format
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+// JWKS returns the public halves of all asymmetric keys. HS256 secrets are
+// never published.
+func (m *KeyManager) JWKS() []JWK {
+	jwks := []JWK{}
+	for _, key := range m.keys {
+		switch publicKey := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwks = append(jwks, JWK{
+				KeyType:   "RSA",
+				KeyID:     key.ID,
+				Algorithm: key.Algorithm,
+				Use:       "sig",
+				N:         base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+				E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks = append(jwks, JWK{
+				KeyType:   "OKP",
+				KeyID:     key.ID,
+				Algorithm: key.Algorithm,
+				Use:       "sig",
+				Curve:     "Ed25519",
+				X:         base64.RawURLEncoding.EncodeToString(publicKey),
+			})
+		}
+	}
+
+	sort.Slice(jwks, func(i, j int) bool { return jwks[i].KeyID < jwks[j].KeyID })
+	return jwks
+}
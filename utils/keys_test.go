@@ -0,0 +1,150 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func encodePEM(t *testing.T, blockType string, der []byte, err error) string {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("encode %s: %v", blockType, err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}))
+}
+
+func TestKeyRotationKeepsOlderTokensValid(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate rsa key: %v", err)
+	}
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ed25519 key: %v", err)
+	}
+	rsaPEM := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}))
+	edDER, err := x509.MarshalPKCS8PrivateKey(edPrivate)
+	edPEM := encodePEM(t, "PRIVATE KEY", edDER, err)
+	edPublicDER, err := x509.MarshalPKIXPublicKey(edPublic)
+	edPublicPEM := encodePEM(t, "PUBLIC KEY", edPublicDER, err)
+
+	hmacKey := KeyConfig{ID: "2023", Algorithm: "HS256", Secret: "old-secret"}
+	before, err := NewKeyManager([]KeyConfig{hmacKey}, "")
+	if err != nil {
+		t.Fatalf("key manager before rotation: %v", err)
+	}
+	after, err := NewKeyManager([]KeyConfig{
+		hmacKey,
+		{ID: "2024", Algorithm: "RS256", PrivateKey: rsaPEM},
+		{ID: "2025", Algorithm: "EdDSA", PrivateKey: edPEM},
+	}, "2024")
+	if err != nil {
+		t.Fatalf("key manager after rotation: %v", err)
+	}
+	next, err := NewKeyManager([]KeyConfig{{ID: "2025", Algorithm: "EdDSA", PrivateKey: edPEM}}, "")
+	if err != nil {
+		t.Fatalf("key manager of the next rotation: %v", err)
+	}
+
+	sign := func(m *KeyManager) string {
+		token, err := m.Sign(jwt.RegisteredClaims{Subject: "1"})
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return token
+	}
+	forged := func(method jwt.SigningMethod, kid string, key interface{}) string {
+		token := jwt.NewWithClaims(method, jwt.RegisteredClaims{Subject: "1"})
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("sign forged token: %v", err)
+		}
+		return signed
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		kid   string
+		valid bool
+	}{
+		{"signed before the rotation", sign(before), "2023", true},
+		{"signed with the active key", sign(after), "2024", true},
+		{"signed with a key that is not active yet", sign(next), "2025", true},
+		{"unknown kid", forged(jwt.SigningMethodHS256, "2022", []byte("old-secret")), "2022", false},
+		{"no kid", forged(jwt.SigningMethodHS256, "", []byte("old-secret")), "", false},
+		{"HS256 under an RS256 kid", forged(jwt.SigningMethodHS256, "2024", x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)), "2024", false},
+		{"EdDSA under an HS256 kid", forged(jwt.SigningMethodEdDSA, "2023", edPrivate), "2023", false},
+	}
+	for _, tt := range tests {
+		token, err := jwt.Parse(tt.token, after.Keyfunc)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: err = %v, want valid = %v", tt.name, err, tt.valid)
+			continue
+		}
+		if kid, _ := token.Header["kid"].(string); kid != tt.kid {
+			t.Errorf("%s: kid = %q, want %q", tt.name, kid, tt.kid)
+		}
+	}
+
+	// Once the old key is dropped its tokens stop verifying
+	if _, err := jwt.Parse(sign(before), next.Keyfunc); err == nil {
+		t.Error("token of a removed key still verifies")
+	}
+
+	// A key kept only to verify can not become the signing key
+	if _, err := NewKeyManager([]KeyConfig{{ID: "2025", Algorithm: "EdDSA", PublicKey: edPublicPEM}}, ""); err == nil {
+		t.Error("public key only config was accepted as the signing key")
+	}
+	if _, err := NewKeyManager([]KeyConfig{hmacKey, hmacKey}, ""); err == nil {
+		t.Error("duplicate kid was accepted")
+	}
+}
+
+func TestJWKSPublishesOnlyPublicKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate rsa key: %v", err)
+	}
+	edPublic, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ed25519 key: %v", err)
+	}
+	rsaDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	rsaPublicPEM := encodePEM(t, "PUBLIC KEY", rsaDER, err)
+	edDER, err := x509.MarshalPKIXPublicKey(edPublic)
+	edPublicPEM := encodePEM(t, "PUBLIC KEY", edDER, err)
+
+	keys, err := NewKeyManager([]KeyConfig{
+		{ID: "hmac", Algorithm: "HS256", Secret: "never-published"},
+		{ID: "rsa", Algorithm: "RS256", PublicKey: rsaPublicPEM},
+		{ID: "ed", Algorithm: "EdDSA", PublicKey: edPublicPEM},
+	}, "")
+	if err != nil {
+		t.Fatalf("key manager: %v", err)
+	}
+
+	want := []JWK{
+		{KeyType: "OKP", KeyID: "ed", Algorithm: "EdDSA", Use: "sig", Curve: "Ed25519", X: base64.RawURLEncoding.EncodeToString(edPublic)},
+		{KeyType: "RSA", KeyID: "rsa", Algorithm: "RS256", Use: "sig", N: base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()), E: "AQAB"},
+	}
+	got := keys.JWKS()
+	if len(got) != len(want) {
+		t.Fatalf("JWKS = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("JWKS[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"go-auth-app/models"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// RememberDevice records that the user logged in from this user-agent and IP
+// address. It reports whether the combination is new for a user who has
+// logged in before; a user's first login is not worth an alert.
+func RememberDevice(userID uint, userAgent, ip string) (bool, error) {
+	fingerprint := HashToken(userAgent + "\n" + ip)
+	now := time.Now()
+
+	result := models.DB.Model(&models.KnownDevice{}).
+		Where("user_id = ? AND fingerprint = ?", userID, fingerprint).
+		Update("last_seen_at", now)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return false, nil
+	}
+
+	var known int64
+	if err := models.DB.Model(&models.KnownDevice{}).Where("user_id = ?", userID).Count(&known).Error; err != nil {
+		return false, err
+	}
+
+	// A concurrent login from the same device may have recorded it first
+	result = models.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.KnownDevice{
+		UserID:      userID,
+		Fingerprint: fingerprint,
+		Device:      DescribeUserAgent(userAgent),
+		IPAddress:   ip,
+		LastSeenAt:  now,
+	})
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected > 0 && known > 0, nil
+}
+
+// CreateLoginReportToken stores a token for the "this wasn't me" link of a
+// new-device email. Unlike CreateEmailToken it leaves earlier tokens valid,
+// since each email reports a different session.
+func CreateLoginReportToken(userID, sessionID uint, ttl time.Duration) (string, error) {
+	token, hash, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	emailToken := models.EmailToken{
+		UserID:    userID,
+		Purpose:   models.EmailTokenLoginReport,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(ttl),
+		SessionID: &sessionID,
+	}
+	if err := models.DB.Create(&emailToken).Error; err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
@@ -2,16 +2,40 @@ package utils
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
 
+	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/joho/godotenv"
-
 	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
+	"golang.org/x/oauth2/github"
+)
+
+// Provider types. OIDC providers are configured through discovery; GitHub
+// does not implement OpenID Connect and is read through its REST API.
+const (
+	ProviderTypeOIDC   = "oidc"
+	ProviderTypeGitHub = "github"
 )
 
-var GoogleOauthConfig *oauth2.Config
+const (
+	googleIssuer   = "https://accounts.google.com"
+	githubAPIURL   = "https://api.github.com"
+	oauthHTTPLimit = 10 * time.Second
+)
+
+var (
+	ErrUnknownProvider      = errors.New("unknown login provider")
+	ErrInvalidIDToken       = errors.New("invalid ID token")
+	ErrMissingIdentityEmail = errors.New("provider did not return an email address")
+)
 
 func init() {
 	if err := godotenv.Load(); err != nil {
@@ -19,28 +43,350 @@ func init() {
 	} else {
 		fmt.Println(".env file loaded successfully")
 	}
-	GoogleOauthConfig = &oauth2.Config{
-		RedirectURL:  os.Getenv("GOOGLE_OAUTH_REDIRECT_URL"),
-		ClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
-		ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
-		Scopes: []string{
-			"https://www.googleapis.com/auth/userinfo.email",
-			"https://www.googleapis.com/auth/userinfo.profile",
-		},
-		Endpoint: google.Endpoint,
+}
+
+// ProviderConfig is one entry of the OIDC_PROVIDERS environment variable
+type ProviderConfig struct {
+	Name         string   `json:"name"`
+	DisplayName  string   `json:"display_name,omitempty"`
+	Type         string   `json:"type,omitempty"`
+	Issuer       string   `json:"issuer,omitempty"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	RedirectURL  string   `json:"redirect_url"`
+	Scopes       []string `json:"scopes,omitempty"`
+}
+
+// ExternalIdentity is the user a provider vouched for at the end of a login
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+}
+
+// OAuthProvider is a configured login provider. OIDC discovery runs on first
+// use so an unreachable provider does not stop the server from starting.
+type OAuthProvider struct {
+	ProviderConfig
+
+	mu       sync.Mutex
+	oauth    *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+	oidc     *oidc.Provider
+}
+
+var (
+	providersOnce sync.Once
+	providers     map[string]*OAuthProvider
+	providersErr  error
+)
+
+// OAuthProviders returns every configured login provider keyed by name.
+// Google is registered from GOOGLE_CLIENT_ID/GOOGLE_CLIENT_SECRET and further
+// providers are read from the OIDC_PROVIDERS JSON array.
+func OAuthProviders() (map[string]*OAuthProvider, error) {
+	providersOnce.Do(func() {
+		providers, providersErr = loadOAuthProviders()
+	})
+	return providers, providersErr
+}
+
+// GetOAuthProvider looks up a configured provider by name
+func GetOAuthProvider(name string) (*OAuthProvider, error) {
+	all, err := OAuthProviders()
+	if err != nil {
+		return nil, err
 	}
+	provider, ok := all[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return provider, nil
 }
 
-// GetGoogleOAuthURL generates the Google OAuth2 URL with state parameter
-func GetGoogleOAuthURL(state string) string {
-	return GoogleOauthConfig.AuthCodeURL(state, oauth2.AccessTypeOnline)
+// OAuthProviderNames returns the names of the configured providers in order
+func OAuthProviderNames() []string {
+	all, _ := OAuthProviders()
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
-// ExchangeCode exchanges the authorization code for an OAuth2 token
-func ExchangeCode(code string) (*oauth2.Token, error) {
-	token, err := GoogleOauthConfig.Exchange(context.Background(), code)
+func loadOAuthProviders() (map[string]*OAuthProvider, error) {
+	var configs []ProviderConfig
+
+	if clientID := os.Getenv("GOOGLE_CLIENT_ID"); clientID != "" {
+		configs = append(configs, ProviderConfig{
+			Name:         "google",
+			DisplayName:  "Google",
+			Issuer:       googleIssuer,
+			ClientID:     clientID,
+			ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("GOOGLE_OAUTH_REDIRECT_URL"),
+		})
+	}
+
+	if raw := os.Getenv("OIDC_PROVIDERS"); raw != "" {
+		var extra []ProviderConfig
+		if err := json.Unmarshal([]byte(raw), &extra); err != nil {
+			return nil, fmt.Errorf("invalid OIDC_PROVIDERS: %w", err)
+		}
+		configs = append(configs, extra...)
+	}
+
+	result := make(map[string]*OAuthProvider, len(configs))
+	for _, cfg := range configs {
+		if cfg.Type == "" {
+			cfg.Type = ProviderTypeOIDC
+		}
+		if cfg.Name == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+			return nil, fmt.Errorf("provider %q needs a name, client_id and redirect_url", cfg.Name)
+		}
+		if cfg.Type == ProviderTypeOIDC && cfg.Issuer == "" {
+			return nil, fmt.Errorf("provider %q needs an issuer", cfg.Name)
+		}
+		if cfg.Type != ProviderTypeOIDC && cfg.Type != ProviderTypeGitHub {
+			return nil, fmt.Errorf("provider %q has unknown type %q", cfg.Name, cfg.Type)
+		}
+		if _, exists := result[cfg.Name]; exists {
+			return nil, fmt.Errorf("provider %q is configured twice", cfg.Name)
+		}
+		if cfg.DisplayName == "" {
+			cfg.DisplayName = cfg.Name
+		}
+		result[cfg.Name] = &OAuthProvider{ProviderConfig: cfg}
+	}
+
+	return result, nil
+}
+
+// oauthContext bounds calls to the provider and makes the oauth2 and oidc
+// packages use a client with a timeout.
+func oauthContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(ctx, oauthHTTPLimit)
+	return oidc.ClientContext(ctx, &http.Client{Timeout: oauthHTTPLimit}), cancel
+}
+
+// config returns the provider's OAuth2 configuration, running OIDC discovery
+// the first time it succeeds.
+func (p *OAuthProvider) config(ctx context.Context) (*oauth2.Config, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.oauth != nil {
+		return p.oauth, nil
+	}
+
+	cfg := &oauth2.Config{
+		ClientID:     p.ClientID,
+		ClientSecret: p.ClientSecret,
+		RedirectURL:  p.RedirectURL,
+		Scopes:       p.Scopes,
+	}
+
+	switch p.Type {
+	case ProviderTypeGitHub:
+		cfg.Endpoint = github.Endpoint
+		if len(cfg.Scopes) == 0 {
+			cfg.Scopes = []string{"read:user", "user:email"}
+		}
+	default:
+		ctx, cancel := oauthContext(ctx)
+		defer cancel()
+
+		provider, err := oidc.NewProvider(ctx, p.Issuer)
+		if err != nil {
+			return nil, fmt.Errorf("OIDC discovery for %s failed: %w", p.Name, err)
+		}
+		cfg.Endpoint = provider.Endpoint()
+		if len(cfg.Scopes) == 0 {
+			cfg.Scopes = []string{oidc.ScopeOpenID, "email", "profile"}
+		}
+		p.oidc = provider
+		p.verifier = provider.Verifier(&oidc.Config{ClientID: p.ClientID})
+	}
+
+	p.oauth = cfg
+	return cfg, nil
+}
+
+// AuthCodeURL returns the URL to send the user to, with a PKCE (S256)
+// challenge for the verifier. The nonce is only used by OIDC providers.
+func (p *OAuthProvider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	cfg, err := p.config(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	opts := []oauth2.AuthCodeOption{oauth2.AccessTypeOnline, oauth2.S256ChallengeOption(verifier)}
+	if p.Type == ProviderTypeOIDC {
+		opts = append(opts, oidc.Nonce(nonce))
+	}
+	return cfg.AuthCodeURL(state, opts...), nil
+}
+
+// Exchange trades an authorization code and its PKCE verifier for the
+// identity of the user. For OIDC providers the ID token signature, issuer,
+// audience, expiry and nonce are verified.
+func (p *OAuthProvider) Exchange(ctx context.Context, code, nonce, verifier string) (*ExternalIdentity, error) {
+	cfg, err := p.config(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return token, nil
+
+	ctx, cancel := oauthContext(ctx)
+	defer cancel()
+
+	token, err := cfg.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, err
+	}
+
+	var identity *ExternalIdentity
+	if p.Type == ProviderTypeGitHub {
+		identity, err = githubIdentity(ctx, cfg.Client(ctx, token))
+	} else {
+		identity, err = p.oidcIdentity(ctx, token, nonce)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if identity.Email == "" {
+		return nil, ErrMissingIdentityEmail
+	}
+	identity.Provider = p.Name
+	return identity, nil
+}
+
+func (p *OAuthProvider) oidcIdentity(ctx context.Context, token *oauth2.Token, nonce string) (*ExternalIdentity, error) {
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, ErrInvalidIDToken
+	}
+
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	if nonce == "" || idToken.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+
+	var claims oidcClaims
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+
+	// Some providers only put the profile in the userinfo response
+	if claims.Email == "" && p.oidc.UserInfoEndpoint() != "" {
+		userInfo, err := p.oidc.UserInfo(ctx, oauth2.StaticTokenSource(token))
+		if err != nil {
+			return nil, err
+		}
+		if userInfo.Subject != idToken.Subject {
+			return nil, fmt.Errorf("%w: userinfo subject mismatch", ErrInvalidIDToken)
+		}
+		if err := userInfo.Claims(&claims); err != nil {
+			return nil, err
+		}
+	}
+
+	return &ExternalIdentity{
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Name:          claims.Name,
+		Picture:       claims.Picture,
+	}, nil
+}
+
+type oidcClaims struct {
+	Email         string   `json:"email"`
+	EmailVerified flexBool `json:"email_verified"`
+	Name          string   `json:"name"`
+	Picture       string   `json:"picture"`
+}
+
+// flexBool accepts both true and "true"; some providers send email_verified
+// as a string.
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		v, err := strconv.ParseBool(s)
+		*b = flexBool(v)
+		return err
+	}
+	var v bool
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*b = flexBool(v)
+	return nil
+}
+
+// githubIdentity reads the user's profile and primary email from the GitHub
+// REST API.
+func githubIdentity(ctx context.Context, client *http.Client) (*ExternalIdentity, error) {
+	var profile struct {
+		ID        int64  `json:"id"`
+		Login     string `json:"login"`
+		Name      string `json:"name"`
+		AvatarURL string `json:"avatar_url"`
+	}
+	if err := githubGet(ctx, client, "/user", &profile); err != nil {
+		return nil, err
+	}
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := githubGet(ctx, client, "/user/emails", &emails); err != nil {
+		return nil, err
+	}
+
+	identity := &ExternalIdentity{
+		Subject: strconv.FormatInt(profile.ID, 10),
+		Name:    profile.Name,
+		Picture: profile.AvatarURL,
+	}
+	if identity.Name == "" {
+		identity.Name = profile.Login
+	}
+	for _, email := range emails {
+		if email.Primary {
+			identity.Email = email.Email
+			identity.EmailVerified = email.Verified
+		}
+	}
+	return identity, nil
+}
+
+func githubGet(ctx context.Context, client *http.Client, path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, githubAPIURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GitHub API %s returned %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
 }
@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"crypto/subtle"
+	"errors"
+	"go-auth-app/models"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+// OAuthStateTTL is how long a user has to finish a login at the provider
+const OAuthStateTTL = 10 * time.Minute
+
+var (
+	ErrInvalidOAuthState  = errors.New("invalid or expired OAuth state")
+	ErrInvalidRedirectURL = errors.New("redirect_to must be a path on the frontend")
+)
+
+// OAuthState is everything the callback needs to check that it completes a
+// login this browser started. It travels in a signed HttpOnly cookie so no
+// server-side storage is needed. LinkUserID is set when a signed-in user is
+// linking the provider account rather than logging in.
+type OAuthState struct {
+	Purpose    string `json:"purpose"`
+	Provider   string `json:"provider"`
+	State      string `json:"state"`
+	Nonce      string `json:"nonce"`
+	Verifier   string `json:"verifier"`
+	RedirectTo string `json:"redirect_to,omitempty"`
+	LinkUserID uint   `json:"link_user_id,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// NewOAuthState generates a fresh state, nonce and PKCE verifier for a login
+// with the provider.
+func NewOAuthState(provider, redirectTo string) (*OAuthState, error) {
+	state, _, err := GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	nonce, _, err := GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	return &OAuthState{
+		Purpose:    models.PurposeOAuthState,
+		Provider:   provider,
+		State:      state,
+		Nonce:      nonce,
+		Verifier:   oauth2.GenerateVerifier(),
+		RedirectTo: redirectTo,
+	}, nil
+}
+
+// SignOAuthState serializes the state into a signed, short-lived token for
+// the state cookie.
+func SignOAuthState(state *OAuthState) (string, error) {
+	registered, err := newRegisteredClaims(OAuthStateTTL)
+	if err != nil {
+		return "", err
+	}
+	state.RegisteredClaims = registered
+
+	keys, err := Keys()
+	if err != nil {
+		return "", err
+	}
+	return keys.Sign(state)
+}
+
+// VerifyOAuthState checks the state cookie against the provider and the state
+// parameter of the callback.
+func VerifyOAuthState(cookie, provider, state string) (*OAuthState, error) {
+	keys, err := Keys()
+	if err != nil {
+		return nil, err
+	}
+
+	var claims OAuthState
+	token, err := newJWTParser(keys).ParseWithClaims(cookie, &claims, keys.Keyfunc)
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidOAuthState
+	}
+
+	if claims.Purpose != models.PurposeOAuthState || claims.Provider != provider {
+		return nil, ErrInvalidOAuthState
+	}
+	if state == "" || subtle.ConstantTimeCompare([]byte(claims.State), []byte(state)) != 1 {
+		return nil, ErrInvalidOAuthState
+	}
+
+	return &claims, nil
+}
+
+// SafeRedirectPath validates a redirect_to value and returns it as a path on
+// the frontend. Relative paths and absolute URLs on the frontend origin are
+// accepted; anything that could send the user to another site is not.
+func SafeRedirectPath(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+	if strings.ContainsAny(raw, "\\\r\n\t") {
+		return "", ErrInvalidRedirectURL
+	}
+
+	target, err := url.Parse(raw)
+	if err != nil {
+		return "", ErrInvalidRedirectURL
+	}
+
+	if target.IsAbs() || target.Host != "" {
+		frontend, err := url.Parse(FrontendURL())
+		if err != nil || target.Scheme != frontend.Scheme || target.Host != frontend.Host {
+			return "", ErrInvalidRedirectURL
+		}
+	} else if !strings.HasPrefix(raw, "/") || strings.HasPrefix(raw, "//") {
+		return "", ErrInvalidRedirectURL
+	}
+
+	path := target.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if strings.HasPrefix(path, "//") || strings.HasPrefix(target.Path, "//") {
+		return "", ErrInvalidRedirectURL
+	}
+	if target.RawQuery != "" {
+		path += "?" + target.RawQuery
+	}
+	if target.Fragment != "" {
+		path += "#" + target.EscapedFragment()
+	}
+	return path, nil
+}
@@ -0,0 +1,42 @@
+package utils
+
+import "testing"
+
+func TestSafeRedirectPath(t *testing.T) {
+	t.Setenv("REACT_FRONTEND_URL", "https://app.example.com/")
+
+	tests := []struct {
+		raw  string
+		want string
+		ok   bool
+	}{
+		{"", "", true},
+		{"/", "/", true},
+		{"/dashboard", "/dashboard", true},
+		{"/jokes?lang=hi&page=2#top", "/jokes?lang=hi&page=2#top", true},
+		{"/a%20b", "/a%20b", true},
+		{"https://app.example.com", "/", true},
+		{"https://app.example.com/settings?tab=security", "/settings?tab=security", true},
+		{"dashboard", "", false},
+		{"//evil.com", "", false},
+		{"///evil.com", "", false},
+		{"/\\evil.com", "", false},
+		{"\\\\evil.com", "", false},
+		{"/\tevil", "", false},
+		{"/dash\r\nLocation: https://evil.com", "", false},
+		{"https://evil.com/", "", false},
+		{"https://app.example.com.evil.com/", "", false},
+		{"https://app.example.com@evil.com/", "", false},
+		{"http://app.example.com/", "", false},
+		{"https://app.example.com//evil.com", "", false},
+		{"javascript:alert(1)", "", false},
+		{"data:text/html,<script>alert(1)</script>", "", false},
+		{"%zz", "", false},
+	}
+	for _, tt := range tests {
+		got, err := SafeRedirectPath(tt.raw)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("SafeRedirectPath(%q) = %q, %v; want %q, ok = %v", tt.raw, got, err, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// bcryptMaxBytes is the longest password bcrypt can hash. Longer passwords
+// would be silently truncated by most implementations, so they are rejected.
+const bcryptMaxBytes = 72
+
+// Password rejection codes, stable for clients to switch on
+const (
+	PasswordRequired     = "required"
+	PasswordTooShort     = "too_short"
+	PasswordTooLong      = "too_long"
+	PasswordPersonalInfo = "contains_personal_info"
+	PasswordBreached     = "breached"
+)
+
+// FieldError describes why one field of a request was rejected
+type FieldError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// FieldErrors maps request fields to the reasons they were rejected
+type FieldErrors map[string][]FieldError
+
+// PasswordPolicy holds the rules new passwords must follow
+type PasswordPolicy struct {
+	MinLength int
+	MaxBytes  int
+}
+
+// CurrentPasswordPolicy returns the policy configured by PASSWORD_MIN_LENGTH
+// and PASSWORD_MAX_LENGTH. The maximum never exceeds bcrypt's 72-byte limit.
+func CurrentPasswordPolicy() PasswordPolicy {
+	policy := PasswordPolicy{MinLength: 8, MaxBytes: bcryptMaxBytes}
+
+	if value, err := strconv.Atoi(os.Getenv("PASSWORD_MIN_LENGTH")); err == nil && value > 0 {
+		policy.MinLength = value
+	}
+	if value, err := strconv.Atoi(os.Getenv("PASSWORD_MAX_LENGTH")); err == nil && value > 0 && value < bcryptMaxBytes {
+		policy.MaxBytes = value
+	}
+	if policy.MinLength > policy.MaxBytes {
+		policy.MinLength = policy.MaxBytes
+	}
+	return policy
+}
+
+// ValidatePassword checks a new password against the policy and the breached
+// password corpus. The email and name of the account are used to reject
+// passwords built from them. It returns nil when the password is acceptable.
+func ValidatePassword(password, email, name string) FieldErrors {
+	policy := CurrentPasswordPolicy()
+	var problems []FieldError
+
+	switch {
+	case password == "":
+		problems = append(problems, FieldError{PasswordRequired, "Password is required"})
+	case utf8.RuneCountInString(password) < policy.MinLength:
+		problems = append(problems, FieldError{PasswordTooShort, fmt.Sprintf("Password must be at least %d characters", policy.MinLength)})
+	case len(password) > policy.MaxBytes:
+		problems = append(problems, FieldError{PasswordTooLong, fmt.Sprintf("Password must be at most %d bytes", policy.MaxBytes)})
+	}
+
+	if password != "" && containsPersonalInfo(password, email, name) {
+		problems = append(problems, FieldError{PasswordPersonalInfo, "Password must not contain your email address or name"})
+	}
+
+	if password != "" && IsBreachedPassword(password) {
+		problems = append(problems, FieldError{PasswordBreached, "This password has appeared in a data breach. Please choose a different one"})
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return FieldErrors{"password": problems}
+}
+
+// containsPersonalInfo reports whether the password contains the email
+// address, its local part or a part of the name. Parts shorter than three
+// characters are ignored so common substrings do not cause rejections.
+func containsPersonalInfo(password, email, name string) bool {
+	lowered := strings.ToLower(password)
+
+	parts := strings.Fields(strings.ToLower(name))
+	if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+		parts = append(parts, email)
+		if at := strings.Index(email, "@"); at > 0 {
+			parts = append(parts, email[:at])
+		}
+	}
+
+	for _, part := range parts {
+		if len(part) >= 3 && strings.Contains(lowered, part) {
+			return true
+		}
+	}
+	return false
+}
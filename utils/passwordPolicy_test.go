@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// useBreachedCorpus loads a corpus with one plain and one HIBP formatted entry
+func useBreachedCorpus(t *testing.T, plain, hashed string) {
+	t.Helper()
+	digest := sha1.Sum([]byte(hashed))
+	corpus := plain + "\n" + strings.ToUpper(hex.EncodeToString(digest[:])) + ":42\r\n"
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte(corpus), 0o600); err != nil {
+		t.Fatalf("write corpus: %v", err)
+	}
+	if entries, err := LoadBreachedPasswords(path); err != nil || entries != 2 {
+		t.Fatalf("load corpus: %d entries, %v", entries, err)
+	}
+	t.Cleanup(func() {
+		breachedMu.Lock()
+		breachedFilter = nil
+		breachedMu.Unlock()
+	})
+}
+
+func TestCurrentPasswordPolicy(t *testing.T) {
+	tests := []struct {
+		min, max string
+		want     PasswordPolicy
+	}{
+		{"", "", PasswordPolicy{MinLength: 8, MaxBytes: 72}},
+		{"12", "64", PasswordPolicy{MinLength: 12, MaxBytes: 64}},
+		{"-1", "abc", PasswordPolicy{MinLength: 8, MaxBytes: 72}},
+		{"8", "100", PasswordPolicy{MinLength: 8, MaxBytes: 72}},
+		{"80", "", PasswordPolicy{MinLength: 72, MaxBytes: 72}},
+	}
+	for _, tt := range tests {
+		t.Setenv("PASSWORD_MIN_LENGTH", tt.min)
+		t.Setenv("PASSWORD_MAX_LENGTH", tt.max)
+		if got := CurrentPasswordPolicy(); got != tt.want {
+			t.Errorf("min %q, max %q: policy = %+v, want %+v", tt.min, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestValidatePassword(t *testing.T) {
+	t.Setenv("PASSWORD_MIN_LENGTH", "")
+	t.Setenv("PASSWORD_MAX_LENGTH", "")
+	useBreachedCorpus(t, "correct horse battery", "Tr0ub4dor&3-long")
+
+	tests := []struct {
+		name     string
+		password string
+		codes    []string
+	}{
+		{"acceptable", "plum-kettle-orbit", nil},
+		{"empty", "", []string{PasswordRequired}},
+		{"short", "abc123", []string{PasswordTooShort}},
+		{"eight runes in more bytes", "ééééüüüü", nil},
+		{"72 bytes", strings.Repeat("x", 72), nil},
+		{"73 bytes", strings.Repeat("x", 73), []string{PasswordTooLong}},
+		{"multibyte over the byte limit", strings.Repeat("é", 37), []string{PasswordTooLong}},
+		{"email", "Alice@Example.com!", []string{PasswordPersonalInfo}},
+		{"local part", "my-alice-password", []string{PasswordPersonalInfo}},
+		{"name", "wonderland-forever", []string{PasswordPersonalInfo}},
+		{"short name parts are ignored", "lt-plum-kettle", nil},
+		{"plain corpus entry", "correct horse battery", []string{PasswordBreached}},
+		{"hashed corpus entry", "Tr0ub4dor&3-long", []string{PasswordBreached}},
+		{"short and personal", "alice1", []string{PasswordTooShort, PasswordPersonalInfo}},
+	}
+	for _, tt := range tests {
+		var codes []string
+		for _, problem := range ValidatePassword(tt.password, "alice@example.com", "Alice Lt Wonderland")["password"] {
+			codes = append(codes, problem.Code)
+		}
+		if !reflect.DeepEqual(codes, tt.codes) {
+			t.Errorf("%s: codes = %v, want %v", tt.name, codes, tt.codes)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package utils
+
+import (
+	"errors"
+	"go-auth-app/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const RefreshTokenTTL = 30 * 24 * time.Hour
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+// IssueRefreshToken creates a new refresh token for the user. An empty
+// familyID starts a new token family.
+func IssueRefreshToken(userID uint, familyID string) (string, error) {
+	token, _, err := issueRefreshToken(models.DB, userID, familyID)
+	return token, err
+}
+
+func issueRefreshToken(db *gorm.DB, userID uint, familyID string) (string, models.RefreshToken, error) {
+	var refreshToken models.RefreshToken
+
+	token, hash, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", refreshToken, err
+	}
+
+	if familyID == "" {
+		familyID, _, err = GenerateOpaqueToken()
+		if err != nil {
+			return "", refreshToken, err
+		}
+	}
+
+	refreshToken = models.RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(RefreshTokenTTL),
+	}
+	if err := db.Create(&refreshToken).Error; err != nil {
+		return "", refreshToken, err
+	}
+
+	return token, refreshToken, nil
+}
+
+// RotateRefreshToken consumes a refresh token and returns a new one from the
+// same family along with its record. Presenting a token that has already been
+// rotated revokes every token in its family and signs its session out, so the
+// access tokens minted from it stop working as well.
+func RotateRefreshToken(token string) (string, models.RefreshToken, error) {
+	var newToken string
+	var replacement models.RefreshToken
+	var reused bool
+	var reusedSessionID uint
+
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		var current models.RefreshToken
+		if err := tx.Where("token_hash = ?", HashToken(token)).First(&current).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+
+		if current.RevokedAt != nil {
+			var err error
+			reused = true
+			reusedSessionID, err = revokeReusedFamily(tx, current.FamilyID)
+			return err
+		}
+
+		if time.Now().After(current.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+
+		// Only one concurrent request may rotate a given token.
+		now := time.Now()
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND revoked_at IS NULL", current.ID).
+			Update("revoked_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			var err error
+			reused = true
+			reusedSessionID, err = revokeReusedFamily(tx, current.FamilyID)
+			return err
+		}
+
+		rotated, next, err := issueRefreshToken(tx, current.UserID, current.FamilyID)
+		if err != nil {
+			return err
+		}
+		newToken = rotated
+		replacement = next
+
+		return tx.Model(&current).Update("replaced_by_id", next.ID).Error
+	})
+
+	if err != nil {
+		return "", models.RefreshToken{}, err
+	}
+	if reused {
+		if reusedSessionID != 0 {
+			markSessionRevoked(reusedSessionID)
+		}
+		return "", models.RefreshToken{}, ErrRefreshTokenReused
+	}
+
+	return newToken, replacement, nil
+}
+
+// RevokeRefreshToken revokes the family the given refresh token belongs to
+func RevokeRefreshToken(token string) error {
+	var current models.RefreshToken
+	if err := models.DB.Where("token_hash = ?", HashToken(token)).First(&current).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidRefreshToken
+		}
+		return err
+	}
+	return revokeRefreshTokenFamily(models.DB, current.FamilyID)
+}
+
+// RevokeUserRefreshTokens revokes every outstanding refresh token of a user
+func RevokeUserRefreshTokens(userID uint) error {
+	return revokeUserRefreshTokens(models.DB, userID)
+}
+
+func revokeUserRefreshTokens(db *gorm.DB, userID uint) error {
+	return db.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// revokeReusedFamily revokes a family whose rotated token was presented again
+// along with the session that owns it. It returns the session's ID, or 0 for
+// families issued before sessions existed.
+func revokeReusedFamily(db *gorm.DB, familyID string) (uint, error) {
+	if err := revokeRefreshTokenFamily(db, familyID); err != nil {
+		return 0, err
+	}
+
+	var session models.Session
+	if err := db.Where("family_id = ? AND revoked_at IS NULL", familyID).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return session.ID, db.Model(&session).Update("revoked_at", time.Now()).Error
+}
+
+func revokeRefreshTokenFamily(db *gorm.DB, familyID string) error {
+	return db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go-auth-app/models"
+)
+
+func TestRotateRefreshTokenDetectsReuse(t *testing.T) {
+	setupTestDB(t)
+
+	user := models.User{Email: "refresh@example.com"}
+	if err := models.DB.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	issue := func() string {
+		token, err := IssueRefreshToken(user.ID, "")
+		if err != nil {
+			t.Fatalf("issue refresh token: %v", err)
+		}
+		return token
+	}
+
+	first := issue()
+	second, _, err := RotateRefreshToken(first)
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	other := issue()
+
+	expired := issue()
+	models.DB.Model(&models.RefreshToken{}).Where("token_hash = ?", HashToken(expired)).Update("expires_at", time.Now().Add(-time.Minute))
+
+	// Run in order: presenting the rotated token revokes its whole family
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"unknown token", "not-a-token", ErrInvalidRefreshToken},
+		{"expired token", expired, ErrInvalidRefreshToken},
+		{"rotated token replayed", first, ErrRefreshTokenReused},
+		{"its replacement after the replay", second, ErrRefreshTokenReused},
+		{"another family", other, nil},
+	}
+	for _, tt := range tests {
+		_, _, err := RotateRefreshToken(tt.token)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestRefreshTokenReuseSignsTheSessionOut(t *testing.T) {
+	setupTestDB(t)
+
+	user := models.User{Email: "stolen@example.com"}
+	if err := models.DB.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	session, err := StartSession(user.ID, models.AuthMethodPassword, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("start session: %v", err)
+	}
+	refreshToken, err := IssueRefreshToken(user.ID, session.FamilyID)
+	if err != nil {
+		t.Fatalf("issue refresh token: %v", err)
+	}
+	accessToken, err := GenerateJWT(user, session.ID)
+	if err != nil {
+		t.Fatalf("generate access token: %v", err)
+	}
+	if _, err := ParseJWT(accessToken); err != nil {
+		t.Fatalf("access token before the replay: %v", err)
+	}
+
+	if _, _, err := RotateRefreshToken(refreshToken); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if _, _, err := RotateRefreshToken(refreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("replay: err = %v, want %v", err, ErrRefreshTokenReused)
+	}
+
+	if _, err := ParseJWT(accessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("access token after the replay: err = %v, want %v", err, ErrTokenRevoked)
+	}
+	var stored models.Session
+	models.DB.First(&stored, session.ID)
+	if stored.RevokedAt == nil {
+		t.Fatal("session was not revoked")
+	}
+}
@@ -0,0 +1,201 @@
+package utils
+
+import (
+	"errors"
+	"go-auth-app/models"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// revocationCacheTTL bounds how long an instance trusts its cached answer
+// before asking Postgres again, so revocations made on other instances are
+// picked up within this window.
+const revocationCacheTTL = 30 * time.Second
+
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+type revocationEntry struct {
+	revoked   bool
+	checkedAt time.Time
+}
+
+type userCutoffEntry struct {
+	cutoff    time.Time
+	checkedAt time.Time
+}
+
+type revocationCache struct {
+	mu       sync.RWMutex
+	tokens   map[string]revocationEntry
+	sessions map[uint]revocationEntry
+	cutoffs  map[uint]userCutoffEntry
+}
+
+var revocations = &revocationCache{
+	tokens:   make(map[string]revocationEntry),
+	sessions: make(map[uint]revocationEntry),
+	cutoffs:  make(map[uint]userCutoffEntry),
+}
+
+// RevokeToken adds a single access token to the revocation list
+func RevokeToken(jti string, userID uint, expiresAt time.Time) error {
+	if jti == "" {
+		return errors.New("token has no jti")
+	}
+
+	revokedToken := models.RevokedToken{JTI: jti, UserID: userID, ExpiresAt: expiresAt}
+	if err := models.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&revokedToken).Error; err != nil {
+		return err
+	}
+
+	revocations.mu.Lock()
+	revocations.tokens[jti] = revocationEntry{revoked: true, checkedAt: time.Now()}
+	revocations.mu.Unlock()
+	return nil
+}
+
+// RevokeAllUserTokens invalidates every access token issued to the user up to now
+func RevokeAllUserTokens(userID uint) error {
+	return revokeAllUserTokens(models.DB, userID)
+}
+
+// RevokeUserAccess signs the user out everywhere: it revokes their access
+// tokens, refresh tokens and sessions. db may be a transaction.
+func RevokeUserAccess(db *gorm.DB, userID uint) error {
+	if err := revokeAllUserTokens(db, userID); err != nil {
+		return err
+	}
+	if err := revokeUserRefreshTokens(db, userID); err != nil {
+		return err
+	}
+	return revokeUserSessions(db, userID)
+}
+
+func revokeAllUserTokens(db *gorm.DB, userID uint) error {
+	cutoff := time.Now()
+	if err := db.Model(&models.User{}).Where("id = ?", userID).Update("tokens_revoked_at", cutoff).Error; err != nil {
+		return err
+	}
+
+	revocations.mu.Lock()
+	revocations.cutoffs[userID] = userCutoffEntry{cutoff: cutoff, checkedAt: time.Now()}
+	revocations.mu.Unlock()
+	return nil
+}
+
+// IsTokenRevoked reports whether the token was revoked individually, by
+// signing out its session or by a user-wide logout.
+func IsTokenRevoked(claims *models.Claims) (bool, error) {
+	if claims.ID != "" {
+		revoked, err := isJTIRevoked(claims.ID)
+		if err != nil || revoked {
+			return revoked, err
+		}
+	}
+
+	if claims.SessionID != 0 {
+		revoked, err := isSessionRevoked(claims.SessionID)
+		if err != nil || revoked {
+			return revoked, err
+		}
+	}
+
+	cutoff, err := userTokenCutoff(claims.UserID)
+	if err != nil {
+		return false, err
+	}
+	if cutoff.IsZero() || claims.IssuedAt == nil {
+		return false, nil
+	}
+
+	// iat only has second precision, so a token from the same second as the
+	// cutoff may predate it. It is revoked unless its session started after
+	// the cutoff, like the login that follows a reset.
+	if issuedAt := claims.IssuedAt.Unix(); issuedAt != cutoff.Unix() {
+		return issuedAt < cutoff.Unix(), nil
+	}
+	if claims.SessionID == 0 {
+		return true, nil
+	}
+	startedAfter, err := sessionStartedAfter(claims.SessionID, cutoff)
+	return !startedAfter, err
+}
+
+func isJTIRevoked(jti string) (bool, error) {
+	revocations.mu.RLock()
+	entry, ok := revocations.tokens[jti]
+	revocations.mu.RUnlock()
+	if ok && (entry.revoked || time.Since(entry.checkedAt) < revocationCacheTTL) {
+		return entry.revoked, nil
+	}
+
+	var count int64
+	if err := models.DB.Model(&models.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error; err != nil {
+		return false, err
+	}
+
+	revocations.mu.Lock()
+	revocations.tokens[jti] = revocationEntry{revoked: count > 0, checkedAt: time.Now()}
+	revocations.mu.Unlock()
+	return count > 0, nil
+}
+
+func userTokenCutoff(userID uint) (time.Time, error) {
+	revocations.mu.RLock()
+	entry, ok := revocations.cutoffs[userID]
+	revocations.mu.RUnlock()
+	if ok && time.Since(entry.checkedAt) < revocationCacheTTL {
+		return entry.cutoff, nil
+	}
+
+	var user models.User
+	err := models.DB.Select("tokens_revoked_at").Where("id = ?", userID).First(&user).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return time.Time{}, err
+	}
+
+	var cutoff time.Time
+	if user.TokensRevokedAt != nil {
+		cutoff = *user.TokensRevokedAt
+	}
+
+	revocations.mu.Lock()
+	revocations.cutoffs[userID] = userCutoffEntry{cutoff: cutoff, checkedAt: time.Now()}
+	revocations.mu.Unlock()
+	return cutoff, nil
+}
+
+// ResetRevocationCache forgets every cached revocation answer. Call it after
+// pointing models.DB at a different database.
+func ResetRevocationCache() {
+	revocations.mu.Lock()
+	revocations.tokens = make(map[string]revocationEntry)
+	revocations.sessions = make(map[uint]revocationEntry)
+	revocations.cutoffs = make(map[uint]userCutoffEntry)
+	revocations.mu.Unlock()
+}
+
+// PruneRevokedTokens deletes revocation rows and cache entries for tokens
+// that have expired anyway.
+func PruneRevokedTokens() error {
+	if err := models.DB.Where("expires_at < ?", time.Now()).Delete(&models.RevokedToken{}).Error; err != nil {
+		return err
+	}
+
+	revocations.mu.Lock()
+	for jti, entry := range revocations.tokens {
+		if time.Since(entry.checkedAt) > AccessTokenTTL+revocationCacheTTL {
+			delete(revocations.tokens, jti)
+		}
+	}
+	for sessionID, entry := range revocations.sessions {
+		if time.Since(entry.checkedAt) > AccessTokenTTL+revocationCacheTTL {
+			delete(revocations.sessions, sessionID)
+		}
+	}
+	revocations.mu.Unlock()
+	return nil
+}
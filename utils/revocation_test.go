@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-auth-app/models"
+
+	"github.com/glebarez/sqlite"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func setupTestDB(t *testing.T) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	if err := models.Migrate(db); err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+
+	previous := models.DB
+	models.DB = db
+	ResetRevocationCache()
+	t.Cleanup(func() {
+		models.DB = previous
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
+
+func TestUserCutoffRevokesTokensFromTheSameSecond(t *testing.T) {
+	setupTestDB(t)
+
+	user := models.User{Email: "revoked@example.com"}
+	if err := models.DB.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	before, err := StartSession(user.ID, models.AuthMethodPassword, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("start session: %v", err)
+	}
+
+	if err := RevokeAllUserTokens(user.ID); err != nil {
+		t.Fatalf("revoke tokens: %v", err)
+	}
+	cutoff, err := userTokenCutoff(user.ID)
+	if err != nil {
+		t.Fatalf("load cutoff: %v", err)
+	}
+
+	after, err := StartSession(user.ID, models.AuthMethodPassword, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("start session: %v", err)
+	}
+
+	second := cutoff.Truncate(time.Second)
+	tests := []struct {
+		name      string
+		issuedAt  time.Time
+		sessionID uint
+		revoked   bool
+	}{
+		{"earlier second", second.Add(-time.Second), before.ID, true},
+		{"same second, older session", second, before.ID, true},
+		{"same second, no session", second, 0, true},
+		{"same second, session started after the cutoff", second, after.ID, false},
+		{"later second", second.Add(time.Second), before.ID, false},
+	}
+	for _, tt := range tests {
+		claims := &models.Claims{
+			UserID:           user.ID,
+			SessionID:        tt.sessionID,
+			RegisteredClaims: jwt.RegisteredClaims{IssuedAt: jwt.NewNumericDate(tt.issuedAt)},
+		}
+		revoked, err := IsTokenRevoked(claims)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if revoked != tt.revoked {
+			t.Errorf("%s: revoked = %v, want %v", tt.name, revoked, tt.revoked)
+		}
+	}
+}
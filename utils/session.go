@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Session modes. In bearer mode clients keep the tokens and send them in the
+// Authorization header. In cookie mode they are kept in HttpOnly cookies the
+// frontend's JavaScript cannot read, and unsafe requests must carry a CSRF
+// token.
+const (
+	SessionModeBearer = "bearer"
+	SessionModeCookie = "cookie"
+)
+
+// Session cookie and header names
+const (
+	AccessTokenCookie  = "access_token"
+	RefreshTokenCookie = "refresh_token"
+	CSRFCookie         = "csrf_token"
+	CSRFHeader         = "X-CSRF-Token"
+	CSRFQueryParam     = "csrf_token"
+)
+
+// SessionMode returns the deployment's session mode from SESSION_MODE
+func SessionMode() string {
+	if strings.EqualFold(os.Getenv("SESSION_MODE"), SessionModeCookie) {
+		return SessionModeCookie
+	}
+	return SessionModeBearer
+}
+
+// CookieSessions reports whether logins should set session cookies
+func CookieSessions() bool {
+	return SessionMode() == SessionModeCookie
+}
+
+// SessionCookieSameSite returns the SameSite attribute for session cookies
+// from SESSION_COOKIE_SAMESITE. Use "none" when the frontend is served from
+// a different site than the API.
+func SessionCookieSameSite() http.SameSite {
+	switch strings.ToLower(os.Getenv("SESSION_COOKIE_SAMESITE")) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
+
+// SessionCookieDomain returns the Domain attribute for session cookies from
+// SESSION_COOKIE_DOMAIN. Empty means host-only cookies.
+func SessionCookieDomain() string {
+	return os.Getenv("SESSION_COOKIE_DOMAIN")
+}
+
+// GenerateCSRFToken returns a random token for double-submit CSRF protection
+func GenerateCSRFToken() (string, error) {
+	token, _, err := GenerateOpaqueToken()
+	return token, err
+}
+
+// ValidCSRFToken reports whether the token sent in the header matches the
+// one in the CSRF cookie.
+func ValidCSRFToken(cookie, header string) bool {
+	if cookie == "" || header == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) == 1
+}
+
+// IsSafeMethod reports whether an HTTP method does not change state and so
+// needs no CSRF token.
+func IsSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key from RFC 4226 and RFC 6238, base32 encoded
+var rfcSecret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestHOTPMatchesRFC4226(t *testing.T) {
+	key := []byte("12345678901234567890")
+	want := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+	for counter, code := range want {
+		if got := hotp(key, int64(counter)); got != code {
+			t.Errorf("hotp(%d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+func TestValidateTOTPMatchesRFC6238(t *testing.T) {
+	// The SHA-1 vectors of RFC 6238 appendix B, truncated to six digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		step, valid := ValidateTOTP(rfcSecret, tt.code, time.Unix(tt.unix, 0))
+		if !valid || step != tt.unix/totpPeriod {
+			t.Errorf("ValidateTOTP(%s at %d) = %d, %v; want %d, true", tt.code, tt.unix, step, valid, tt.unix/totpPeriod)
+		}
+	}
+}
+
+func TestValidateTOTPDrift(t *testing.T) {
+	issued := time.Unix(1234567890, 0)
+	tests := []struct {
+		name  string
+		now   time.Time
+		code  string
+		valid bool
+	}{
+		{"same step", issued, "005924", true},
+		{"spaces", issued, " 005 924 ", true},
+		{"one step late", issued.Add(totpPeriod * time.Second), "005924", true},
+		{"one step early", issued.Add(-totpPeriod * time.Second), "005924", true},
+		{"two steps late", issued.Add(2 * totpPeriod * time.Second), "005924", false},
+		{"wrong code", issued, "005925", false},
+		{"too short", issued, "05924", false},
+	}
+	for _, tt := range tests {
+		if _, valid := ValidateTOTP(rfcSecret, tt.code, tt.now); valid != tt.valid {
+			t.Errorf("%s: valid = %v, want %v", tt.name, valid, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package utils
+
+import "strings"
+
+// DescribeUserAgent turns a User-Agent header into an approximate device
+// description such as "Chrome on Windows" for showing to users.
+func DescribeUserAgent(userAgent string) string {
+	if userAgent == "" {
+		return "Unknown device"
+	}
+	ua := strings.ToLower(userAgent)
+
+	browser := "Unknown browser"
+	for _, candidate := range []struct{ token, name string }{
+		{"edg/", "Edge"},
+		{"opr/", "Opera"},
+		{"samsungbrowser", "Samsung Internet"},
+		{"firefox/", "Firefox"},
+		{"fxios", "Firefox"},
+		{"crios", "Chrome"},
+		{"chrome/", "Chrome"},
+		{"safari/", "Safari"},
+		{"curl/", "curl"},
+		{"python-requests", "Python"},
+		{"go-http-client", "Go"},
+		{"postmanruntime", "Postman"},
+	} {
+		if strings.Contains(ua, candidate.token) {
+			browser = candidate.name
+			break
+		}
+	}
+
+	platform := ""
+	for _, candidate := range []struct{ token, name string }{
+		{"iphone", "iPhone"},
+		{"ipad", "iPad"},
+		{"android", "Android"},
+		{"windows", "Windows"},
+		{"cros", "ChromeOS"},
+		{"mac os x", "macOS"},
+		{"macintosh", "macOS"},
+		{"linux", "Linux"},
+	} {
+		if strings.Contains(ua, candidate.token) {
+			platform = candidate.name
+			break
+		}
+	}
+
+	if platform == "" {
+		return browser
+	}
+	return browser + " on " + platform
+}
@@ -0,0 +1,183 @@
+package utils
+
+import (
+	"errors"
+	"go-auth-app/models"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// sessionTouchInterval limits how often last_seen_at is written for a busy
+// session.
+const sessionTouchInterval = 5 * time.Minute
+
+// maxUserAgentLength keeps oversized headers out of the sessions table
+const maxUserAgentLength = 512
+
+var ErrSessionNotFound = errors.New("session not found")
+
+var sessionTouches sync.Map
+
+// StartSession records a new login and returns it. The session's FamilyID
+// starts the refresh token family for the login.
+func StartSession(userID uint, authMethod, userAgent, ip string) (*models.Session, error) {
+	familyID, _, err := GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	return createSession(userID, familyID, authMethod, userAgent, ip)
+}
+
+// SessionForFamily returns the session owning a refresh token family and
+// records the refresh as activity. Families issued before sessions existed
+// get a session on their first refresh.
+func SessionForFamily(userID uint, familyID, userAgent, ip string) (*models.Session, error) {
+	var session models.Session
+	err := models.DB.Where("family_id = ?", familyID).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return createSession(userID, familyID, "", userAgent, ip)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if err := models.DB.Model(&session).Updates(map[string]interface{}{
+		"last_seen_at": now,
+		"ip_address":   ip,
+		"expires_at":   now.Add(RefreshTokenTTL),
+	}).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func createSession(userID uint, familyID, authMethod, userAgent, ip string) (*models.Session, error) {
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	now := time.Now()
+	session := models.Session{
+		UserID:     userID,
+		FamilyID:   familyID,
+		AuthMethod: authMethod,
+		UserAgent:  userAgent,
+		Device:     DescribeUserAgent(userAgent),
+		IPAddress:  ip,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(RefreshTokenTTL),
+	}
+	if err := models.DB.Create(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// ListSessions returns the user's sessions that are still signed in
+func ListSessions(userID uint) ([]models.Session, error) {
+	var sessions []models.Session
+	err := models.DB.
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// RevokeSession signs a device out: its refresh tokens stop working and its
+// access tokens are rejected by IsAuthorized.
+func RevokeSession(userID, sessionID uint) error {
+	var session models.Session
+	if err := models.DB.Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSessionNotFound
+		}
+		return err
+	}
+
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&session).Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return revokeRefreshTokenFamily(tx, session.FamilyID)
+	})
+	if err != nil {
+		return err
+	}
+
+	markSessionRevoked(sessionID)
+	return nil
+}
+
+// markSessionRevoked records a revoked session in the revocation cache so
+// its access tokens are rejected without waiting for the cache to expire
+func markSessionRevoked(sessionID uint) {
+	revocations.mu.Lock()
+	revocations.sessions[sessionID] = revocationEntry{revoked: true, checkedAt: time.Now()}
+	revocations.mu.Unlock()
+}
+
+// RevokeUserSessions marks every session of the user as signed out. Their
+// tokens are revoked separately by RevokeAllUserTokens and
+// RevokeUserRefreshTokens.
+func RevokeUserSessions(userID uint) error {
+	return revokeUserSessions(models.DB, userID)
+}
+
+func revokeUserSessions(db *gorm.DB, userID uint) error {
+	return db.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// TouchSession records that the session was just used. Writes are throttled
+// per instance so busy sessions do not write on every request.
+func TouchSession(sessionID uint, ip string) error {
+	if sessionID == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	if last, ok := sessionTouches.Load(sessionID); ok && now.Sub(last.(time.Time)) < sessionTouchInterval {
+		return nil
+	}
+	sessionTouches.Store(sessionID, now)
+
+	return models.DB.Model(&models.Session{}).Where("id = ?", sessionID).Updates(map[string]interface{}{
+		"last_seen_at": now,
+		"ip_address":   ip,
+	}).Error
+}
+
+func isSessionRevoked(sessionID uint) (bool, error) {
+	revocations.mu.RLock()
+	entry, ok := revocations.sessions[sessionID]
+	revocations.mu.RUnlock()
+	if ok && (entry.revoked || time.Since(entry.checkedAt) < revocationCacheTTL) {
+		return entry.revoked, nil
+	}
+
+	var count int64
+	if err := models.DB.Model(&models.Session{}).Where("id = ? AND revoked_at IS NOT NULL", sessionID).Count(&count).Error; err != nil {
+		return false, err
+	}
+
+	revocations.mu.Lock()
+	revocations.sessions[sessionID] = revocationEntry{revoked: count > 0, checkedAt: time.Now()}
+	revocations.mu.Unlock()
+	return count > 0, nil
+}
+
+// sessionStartedAfter reports whether the session was created after t
+func sessionStartedAfter(sessionID uint, t time.Time) (bool, error) {
+	var session models.Session
+	if err := models.DB.Select("created_at").Where("id = ?", sessionID).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return session.CreatedAt.After(t), nil
+}
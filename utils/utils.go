@@ -2,32 +2,37 @@ package utils
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"html/template"
-	"log"
 	"os"
 	"strconv"
+	"strings"
 
 	"gopkg.in/gomail.v2"
 )
 
-func SendEmail(to string, subject string, templateFile string, data interface{}) {
+// SendEmail renders the HTML template with data and sends it to the address.
+// Misconfiguration is returned as an error so a failed email never takes the
+// server down.
+func SendEmail(to string, subject string, templateFile string, data interface{}) error {
 	email := os.Getenv("EMAIL_ADDRESS")
 	password := os.Getenv("EMAIL_PASSWORD")
 	smtpHost := os.Getenv("SMTP_HOST")
 	smtpPort := os.Getenv("SMTP_PORT")
 
 	if email == "" || password == "" || smtpHost == "" || smtpPort == "" {
-		log.Fatalf("Missing required email configuration environment variables")
+		return errors.New("missing required email configuration environment variables")
 	}
 
 	tmpl, err := template.ParseFiles(templateFile)
 	if err != nil {
-		log.Fatalf("Error parsing email template: %v", err)
+		return fmt.Errorf("error parsing email template: %w", err)
 	}
 
 	var body bytes.Buffer
 	if err := tmpl.Execute(&body, data); err != nil {
-		log.Fatalf("Error executing email template: %v", err)
+		return fmt.Errorf("error executing email template: %w", err)
 	}
 
 	mailer := gomail.NewMessage()
@@ -39,7 +44,7 @@ func SendEmail(to string, subject string, templateFile string, data interface{})
 	// Convert SMTP port to an integer
 	port, err := strconv.Atoi(smtpPort)
 	if err != nil {
-		log.Fatalf("Invalid SMTP port: %v", err)
+		return fmt.Errorf("invalid SMTP port: %w", err)
 	}
 
 	// Set up the email dialer
@@ -47,6 +52,15 @@ func SendEmail(to string, subject string, templateFile string, data interface{})
 
 	// Send the email
 	if err := dialer.DialAndSend(mailer); err != nil {
-		log.Printf("Failed to send email: %v", err)
+		return fmt.Errorf("failed to send email: %w", err)
 	}
+	return nil
+}
+
+// FrontendURL returns the base URL of the React frontend
+func FrontendURL() string {
+	if url := os.Getenv("REACT_FRONTEND_URL"); url != "" {
+		return strings.TrimSuffix(url, "/")
+	}
+	return "https://jokemaster-go.netlify.app"
 }
@@ -0,0 +1,195 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"go-auth-app/models"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+const (
+	WebAuthnCeremonyRegistration = "registration"
+	WebAuthnCeremonyLogin        = "login"
+
+	webAuthnSessionTTL = 5 * time.Minute
+)
+
+var ErrInvalidWebAuthnSession = errors.New("invalid or expired webauthn session")
+
+var (
+	webAuthnOnce     sync.Once
+	webAuthnInstance *webauthn.WebAuthn
+	webAuthnErr      error
+)
+
+// WebAuthn returns the relying party configured from the WEBAUTHN_*
+// environment variables.
+func WebAuthn() (*webauthn.WebAuthn, error) {
+	webAuthnOnce.Do(func() {
+		origins := strings.Split(os.Getenv("WEBAUTHN_RP_ORIGINS"), ",")
+		if os.Getenv("WEBAUTHN_RP_ORIGINS") == "" {
+			origins = []string{"http://localhost:3000"}
+		}
+		for i := range origins {
+			origins[i] = strings.TrimSpace(origins[i])
+		}
+
+		rpID := os.Getenv("WEBAUTHN_RP_ID")
+		if rpID == "" {
+			rpID = "localhost"
+		}
+
+		webAuthnInstance, webAuthnErr = webauthn.New(&webauthn.Config{
+			RPID:          rpID,
+			RPDisplayName: "JokeMaster",
+			RPOrigins:     origins,
+			AuthenticatorSelection: protocol.AuthenticatorSelection{
+				ResidentKey:      protocol.ResidentKeyRequirementPreferred,
+				UserVerification: protocol.VerificationPreferred,
+			},
+		})
+	})
+	return webAuthnInstance, webAuthnErr
+}
+
+// WebAuthnUser adapts a user and their passkeys to the webauthn.User interface
+type WebAuthnUser struct {
+	User        models.User
+	Credentials []models.WebAuthnCredential
+}
+
+func (u WebAuthnUser) WebAuthnID() []byte {
+	return u.User.WebAuthnHandle
+}
+
+func (u WebAuthnUser) WebAuthnName() string {
+	return u.User.Email
+}
+
+func (u WebAuthnUser) WebAuthnDisplayName() string {
+	if u.User.Name != "" {
+		return u.User.Name
+	}
+	return u.User.Email
+}
+
+func (u WebAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.Credentials))
+	for _, stored := range u.Credentials {
+		var transports []protocol.AuthenticatorTransport
+		for _, transport := range strings.Split(stored.Transports, ",") {
+			if transport != "" {
+				transports = append(transports, protocol.AuthenticatorTransport(transport))
+			}
+		}
+
+		credentials = append(credentials, webauthn.Credential{
+			ID:              stored.CredentialID,
+			PublicKey:       stored.PublicKey,
+			AttestationType: stored.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				UserVerified:   stored.UserVerified,
+				BackupEligible: stored.BackupEligible,
+				BackupState:    stored.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:       stored.AAGUID,
+				SignCount:    stored.SignCount,
+				CloneWarning: stored.CloneWarning,
+			},
+		})
+	}
+	return credentials
+}
+
+// LoadWebAuthnUser loads a user together with their passkeys, assigning the
+// user a random WebAuthn handle on first use.
+func LoadWebAuthnUser(userID uint) (WebAuthnUser, error) {
+	var user models.User
+	if err := models.DB.First(&user, userID).Error; err != nil {
+		return WebAuthnUser{}, err
+	}
+
+	if len(user.WebAuthnHandle) == 0 {
+		handle := make([]byte, 32)
+		if _, err := rand.Read(handle); err != nil {
+			return WebAuthnUser{}, err
+		}
+		if err := models.DB.Model(&user).Updates(models.User{WebAuthnHandle: handle}).Error; err != nil {
+			return WebAuthnUser{}, err
+		}
+		user.WebAuthnHandle = handle
+	}
+
+	var credentials []models.WebAuthnCredential
+	if err := models.DB.Where("user_id = ?", user.ID).Find(&credentials).Error; err != nil {
+		return WebAuthnUser{}, err
+	}
+
+	return WebAuthnUser{User: user, Credentials: credentials}, nil
+}
+
+// SaveWebAuthnSession persists ceremony state and returns the opaque ID the
+// client must send back to finish the ceremony.
+func SaveWebAuthnSession(userID uint, ceremony string, session *webauthn.SessionData) (string, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+
+	token, hash, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	record := models.WebAuthnSession{
+		TokenHash: hash,
+		UserID:    userID,
+		Ceremony:  ceremony,
+		Data:      data,
+		ExpiresAt: time.Now().Add(webAuthnSessionTTL),
+	}
+	if err := models.DB.Create(&record).Error; err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// ConsumeWebAuthnSession loads and deletes ceremony state so that every
+// challenge can only be answered once. It also returns the user the ceremony
+// was started for, which is zero for discoverable logins.
+func ConsumeWebAuthnSession(token string, ceremony string) (webauthn.SessionData, uint, error) {
+	var session webauthn.SessionData
+
+	var record models.WebAuthnSession
+	if err := models.DB.Where("token_hash = ? AND ceremony = ?", HashToken(token), ceremony).First(&record).Error; err != nil {
+		return session, 0, ErrInvalidWebAuthnSession
+	}
+
+	result := models.DB.Delete(&models.WebAuthnSession{}, record.ID)
+	if result.Error != nil {
+		return session, 0, result.Error
+	}
+	if result.RowsAffected == 0 || time.Now().After(record.ExpiresAt) {
+		return session, 0, ErrInvalidWebAuthnSession
+	}
+
+	if err := json.Unmarshal(record.Data, &session); err != nil {
+		return session, 0, err
+	}
+	return session, record.UserID, nil
+}
+
+// PruneWebAuthnSessions removes ceremonies that were never finished
+func PruneWebAuthnSessions() error {
+	return models.DB.Where("expires_at < ?", time.Now()).Delete(&models.WebAuthnSession{}).Error
+}